@@ -0,0 +1,1322 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"kursovaya/imageio"
+	"kursovaya/stego"
+)
+
+const usage = `Usage:
+  stegocli embed   -cover <image> -out <image> [options] <file or dir>...
+  stegocli extract -in <image> -out <file or dir> [options] [entry...]
+  stegocli list    -in <image> [options]
+  stegocli detect  -in <image> [options]
+  stegocli split   -cover <image> -cover <image>... -out <image> [options] <file or dir>...
+  stegocli share   -k <threshold> -cover <image> -cover <image>... -out <image> [options] <file or dir>...
+  stegocli join    -out <file or dir> [options] <image>... [-- entry...]
+  stegocli dual    -cover <image> -out <image> -decoy-password <key> [-hidden <file or dir>... -hidden-password <key>] [options] <decoy file or dir>...
+  stegocli profile -out <profile.json|profile.toml> [-name <name>] [options]
+  stegocli algorithms
+  stegocli keygen  -out <name> [-sign]
+  stegocli export  -key <private key> [-out <public key>]
+  stegocli import  -in <key> -out <pem> [-private]
+
+Payloads can be encrypted with -password or one or more -recipient public keys
+and decrypted with -password or -identity private keys. The password may also
+be given in the STEGOCLI_PASSWORD environment variable. Options on the command
+line are visible to other users of the machine; every password and passphrase
+option therefore has a -file variant, such as -password-file or
+-passphrase-file, that reads the value from a file without its trailing line
+break (/dev/stdin reads it from a pipe). Payloads are signed
+with -sign and verified against a -keyring of trusted Ed25519 public keys;
+with -keyring, unsigned payloads are refused.
+Images made by "dual" are read with "extract -deniable -password <key>".
+Every command running an algorithm accepts -profile <file> with settings
+saved by "profile"; options given on the command line take precedence.
+A profile of the split, share or deniable mode is refused by the commands of
+the other modes.
+With -detect, extract and list find the algorithm and fractal parameters
+themselves, trying the given parameters first.
+Covers may be PNG, GIF, BMP, TIFF, PPM/PGM, WebP or JPEG. Stego images are
+written in the format given by -format or by the -out extension: PNG, GIF,
+BMP, TIFF, PPM/PGM or lossless WebP, and PNG for unknown extensions. JPEG and
+formats that cannot hold the image exactly are refused. GIF output needs the
+palette algorithm, which keeps GIF and palette PNG covers paletted. PNG stego
+images keep the metadata chunks of PNG covers, such as gAMA, iCCP, pHYs and
+tEXt, and their compression level unless -compression is given. Saved stego
+images are read back and extracted to check that the payload survived;
+-verify=false skips the check.
+Animated GIF and APNG covers carry the payload spread over their frames and
+keep their timings; with other algorithms than palette, such as fractal, the
+frames become true color and are saved as APNG: give -out a .png name. The
+palette algorithm writes APNG only when all frames share one palette. Covers
+that cannot be saved in the chosen output are refused before embedding.
+
+Run "stegocli <command> -h" to see the options of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "embed":
+		err = runEmbed(os.Args[2:])
+	case "extract":
+		err = runExtract(os.Args[2:])
+	case "list":
+		err = runList(os.Args[2:])
+	case "detect":
+		err = runDetect(os.Args[2:])
+	case "split":
+		err = runSplit(os.Args[2:])
+	case "share":
+		err = runShare(os.Args[2:])
+	case "join":
+		err = runJoin(os.Args[2:])
+	case "dual":
+		err = runDual(os.Args[2:])
+	case "profile":
+		err = runProfile(os.Args[2:])
+	case "algorithms":
+		runAlgorithms()
+		return
+	case "keygen":
+		err = runKeygen(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// stringList is a flag that can be repeated to collect several values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// secretFileFlag adds -<name>-file, which reads the value of the secret option name from a
+// file so that it does not show up in the process list. A trailing line break is dropped.
+func secretFileFlag(fs *flag.FlagSet, name string, set func(value string)) {
+	fs.Func(name+"-file", fmt.Sprintf("read -%s from a file", name), func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		set(strings.TrimRight(string(data), "\r\n"))
+		return nil
+	})
+}
+
+// algorithmFlags holds the options shared by all commands that run an algorithm
+type algorithmFlags struct {
+	algorithm string
+	rate      float64
+	region    string
+	params    map[string]string
+	maskCache string
+	detect    bool
+}
+
+// register adds the common flags and one flag per parameter in the schemas of the registered algorithms
+func (f *algorithmFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.algorithm, "algorithm", "fractal",
+		"steganography algorithm: "+strings.Join(stego.Algorithms(), ", "))
+	fs.Float64Var(&f.rate, "rate", 0.4, "embedding rate (0.0-1.0)")
+	fs.StringVar(&f.region, "region", "",
+		"rectangle x0,y0,x1,y1 of the image that carries the data (default whole image)")
+	fs.String("profile", "", "JSON or TOML profile supplying defaults for the options not given")
+	fs.StringVar(&f.maskCache, "mask-cache", os.Getenv("STEGOCLI_MASK_CACHE"),
+		"directory persisting the fractal masks of large images between runs; masks derived from a passphrase stay in memory")
+
+	f.params = make(map[string]string)
+	for _, info := range stego.Registered() {
+		for _, spec := range info.Schema {
+			if fs.Lookup(spec.Name) != nil {
+				continue
+			}
+			usage := fmt.Sprintf("%s, %s parameter (default %s)",
+				spec.HelpText(stego.DefaultLanguage), info.ID, spec.FormatValue(spec.Default))
+			name := spec.Name
+			fs.Func(name, usage, func(value string) error {
+				f.params[name] = value
+				return nil
+			})
+			if spec.Secret {
+				secretFileFlag(fs, name, func(value string) { f.params[name] = value })
+			}
+		}
+	}
+}
+
+func (f *algorithmFlags) build() (stego.Steganographer, stego.Config, error) {
+	info, ok := stego.Lookup(f.algorithm)
+	if !ok {
+		return nil, stego.Config{}, fmt.Errorf("unknown steganography algorithm: %s", f.algorithm)
+	}
+
+	params, err := f.parseParams(info)
+	if err != nil {
+		return nil, stego.Config{}, err
+	}
+
+	region, err := stego.ParseRegion(f.region)
+	if err != nil {
+		return nil, stego.Config{}, err
+	}
+
+	if f.maskCache != "" {
+		opts := stego.DefaultMaskCacheOptions
+		opts.Dir = f.maskCache
+		stego.ConfigureMaskCache(opts)
+	}
+
+	config := stego.Config{
+		EmbeddingRate: f.rate,
+		Params:        params,
+		Region:        region,
+	}
+
+	return info.New(), config, nil
+}
+
+// parseParams checks the parameter flags against the schema of the algorithm
+func (f *algorithmFlags) parseParams(info stego.AlgorithmInfo) (stego.Params, error) {
+	params := make(stego.Params)
+	for name, text := range f.params {
+		spec, ok := info.Schema.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("algorithm %s has no parameter %s", info.ID, name)
+		}
+		v, err := spec.Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		params[name] = v
+	}
+
+	return info.Schema.Resolve(params)
+}
+
+// storedParams returns the parameters given on the command line as a detection candidate
+func (f *algorithmFlags) storedParams() []stego.Params {
+	// Parse the values with the schema of each algorithm that accepts them
+	var stored []stego.Params
+	for _, info := range stego.Registered() {
+		if resolved, err := f.parseParams(info); err == nil {
+			stored = append(stored, resolved)
+		}
+	}
+	return stored
+}
+
+// parseFlags parses the arguments and fills the options not given on the command line from the -profile
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	_ = fs.Parse(args)
+
+	profileFlag := fs.Lookup("profile")
+	if profileFlag == nil || profileFlag.Value.String() == "" {
+		return nil
+	}
+	profile, err := stego.LoadProfile(profileFlag.Value.String())
+	if err != nil {
+		return err
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for name, values := range profileFlagValues(profile) {
+		if given[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("profile %s: %w", name, err)
+			}
+		}
+	}
+
+	return checkProfile(fs, profileFlag.Value.String(), profile)
+}
+
+// commandModes lists the profile modes each command honours; the others accept any mode
+var commandModes = map[string][]string{
+	"embed":   {stego.ModeSingle},
+	"extract": {stego.ModeSingle, stego.ModeDeniable},
+	"list":    {stego.ModeSingle, stego.ModeDeniable},
+	"split":   {stego.ModeSplit},
+	"share":   {stego.ModeShare},
+	"join":    {stego.ModeSplit, stego.ModeShare},
+	"dual":    {stego.ModeDeniable},
+}
+
+// checkProfile rejects profile settings the command cannot honour, rather than ignoring them
+func checkProfile(fs *flag.FlagSet, path string, p *stego.Profile) error {
+	if modes, ok := commandModes[fs.Name()]; ok && !slices.Contains(modes, p.Mode) {
+		return fmt.Errorf("profile %s is for the %s mode, which the %s command does not use", path, p.Mode, fs.Name())
+	}
+
+	// Only the commands encrypting a payload have -recipient next to -password
+	password := fs.Lookup("password")
+	if p.Encryption == stego.EncryptionPassword && fs.Lookup("recipient") != nil && password != nil && password.Value.String() == "" {
+		return fmt.Errorf("profile %s encrypts with a password; give -password, -password-file or STEGOCLI_PASSWORD", path)
+	}
+
+	return nil
+}
+
+// profileFlagValues maps the profile settings to command line flags
+func profileFlagValues(p *stego.Profile) map[string][]string {
+	values := map[string][]string{
+		"name":       {p.Name},
+		"algorithm":  {p.Algorithm},
+		"rate":       {strconv.FormatFloat(p.EmbeddingRate, 'g', -1, 64)},
+		"region":     {p.Region},
+		"mode":       {p.Mode},
+		"encryption": {p.Encryption},
+	}
+
+	info, _ := stego.Lookup(p.Algorithm)
+	for _, spec := range info.Schema {
+		if v, ok := p.Params[spec.Name]; ok {
+			values[spec.Name] = []string{spec.FormatValue(v)}
+		}
+	}
+
+	if p.Mode == stego.ModeDeniable {
+		values["deniable"] = []string{"true"}
+	}
+	if p.Mode == stego.ModeShare {
+		values["k"] = []string{strconv.Itoa(p.ShareThreshold)}
+	}
+	if p.Encryption == stego.EncryptionRecipients {
+		values["recipient"] = p.Recipients
+	}
+	if p.SigningKey != "" {
+		values["sign"] = []string{p.SigningKey}
+	}
+	if p.Keyring != "" {
+		values["keyring"] = []string{p.Keyring}
+	}
+
+	return values
+}
+
+// outputFlags holds the format, compression and verification options of the commands writing stego images
+type outputFlags struct {
+	format      string
+	compression string
+	verify      bool
+
+	level imageio.Compression
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "format", "", fmt.Sprintf("stego image format: %s (default from the -out extension, png when unknown)",
+		strings.Join(imageio.WritableFormats(), ", ")))
+	fs.StringVar(&f.compression, "compression", imageio.CompressionCover.String(),
+		fmt.Sprintf("PNG compression: %s; cover matches the level of a PNG cover", strings.Join(imageio.CompressionNames(), ", ")))
+	fs.BoolVar(&f.verify, "verify", true, "re-read the saved stego image and check that the payload extracts from it")
+}
+
+// check rejects unknown and lossy formats and unknown compressions before any work is done
+func (f *outputFlags) check(out string) error {
+	if err := imageio.CheckOutput(out, f.format); err != nil {
+		return err
+	}
+	var err error
+	f.level, err = imageio.ParseCompression(f.compression)
+	return err
+}
+
+// checkCover rejects, before anything is embedded, an output the stego image of the cover, or
+// of a still image when cover is nil, cannot be saved in with the algorithm
+func (f *outputFlags) checkCover(out string, algorithm stego.Steganographer, cover *imageio.Animation) error {
+	info, _ := stego.Lookup(algorithm.Name())
+	return imageio.CheckAnimationOutput(out, f.format, cover, info.KeepsPalette)
+}
+
+// options returns how the stego image made from the cover is saved. PNG output keeps the
+// metadata chunks of a PNG cover.
+func (f *outputFlags) options(cover string) imageio.SaveOptions {
+	return imageio.SaveOptions{Format: f.format, Cover: cover, Compression: f.level}
+}
+
+// verifySaved checks that extract reads the payload back from the saved stego images
+func (f *outputFlags) verifySaved(want []byte, extract func() ([]byte, error)) error {
+	if !f.verify {
+		return nil
+	}
+	return stego.Verify(want, extract)
+}
+
+// verifySavedStream is verifySaved for a streamed payload with the SHA-256 digest want
+func (f *outputFlags) verifySavedStream(want []byte, extract func(w io.Writer) error) error {
+	if !f.verify {
+		return nil
+	}
+	return stego.VerifyStream(want, extract)
+}
+
+// protectFlags holds the encryption and signing options of the embedding commands
+type protectFlags struct {
+	password   string
+	recipients stringList
+	signKey    string
+}
+
+func (f *protectFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.password, "password", os.Getenv("STEGOCLI_PASSWORD"), "encrypt the payload with a password")
+	secretFileFlag(fs, "password", func(value string) { f.password = value })
+	fs.Var(&f.recipients, "recipient", "encrypt the payload to an X25519 public key file (repeatable)")
+	fs.StringVar(&f.signKey, "sign", "", "sign the payload with an Ed25519 private key file")
+}
+
+// plain reports whether the payload is neither encrypted nor signed
+func (f *protectFlags) plain() bool {
+	return f.password == "" && len(f.recipients) == 0 && f.signKey == ""
+}
+
+// apply encrypts and then signs the payload
+func (f *protectFlags) apply(data []byte) ([]byte, error) {
+	opts := stego.EncryptOptions{Password: f.password}
+	for _, path := range f.recipients {
+		key, err := stego.LoadRecipientKey(path)
+		if err != nil {
+			return nil, err
+		}
+		opts.Recipients = append(opts.Recipients, key)
+	}
+
+	data, err := stego.Encrypt(data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	if f.signKey != "" {
+		key, err := stego.LoadSigningKey(f.signKey)
+		if err != nil {
+			return nil, err
+		}
+		data = stego.Sign(data, key)
+	}
+
+	return data, nil
+}
+
+// openFlags holds the keys of the extracting commands
+type openFlags struct {
+	password   string
+	identities stringList
+	keyring    string
+	deniable   bool
+}
+
+func (f *openFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.password, "password", os.Getenv("STEGOCLI_PASSWORD"), "password of an encrypted payload")
+	secretFileFlag(fs, "password", func(value string) { f.password = value })
+	fs.Var(&f.identities, "identity", "X25519 private key file for an encrypted payload (repeatable)")
+	fs.StringVar(&f.keyring, "keyring", "", "file or directory of trusted Ed25519 signer public keys")
+}
+
+// apply verifies the signature, reports the signer and decrypts the payload
+func (f *openFlags) apply(data []byte) ([]byte, error) {
+	var keyring *stego.Keyring
+	if f.keyring != "" {
+		var err error
+		keyring, err = stego.LoadKeyring(f.keyring)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, info, err := stego.VerifySignature(data, keyring)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		fmt.Fprintln(os.Stderr, info)
+	}
+
+	opts := stego.DecryptOptions{Password: f.password}
+	for _, path := range f.identities {
+		key, err := stego.LoadIdentity(path)
+		if err != nil {
+			return nil, err
+		}
+		opts.Identities = append(opts.Identities, key)
+	}
+
+	return stego.Decrypt(data, opts)
+}
+
+func runEmbed(args []string) error {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	cover := fs.String("cover", "", "cover image")
+	out := fs.String("out", "", "output stego image")
+	var outFlags outputFlags
+	outFlags.register(fs)
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	var protFlags protectFlags
+	protFlags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *cover == "" || *out == "" {
+		return errors.New("both -cover and -out are required")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no files to embed")
+	}
+	if err := outFlags.check(*out); err != nil {
+		return err
+	}
+
+	algorithm, config, err := algFlags.build()
+	if err != nil {
+		return err
+	}
+
+	coverAnimation, err := imageio.LoadAnimation(*cover)
+	if err != nil {
+		return fmt.Errorf("failed to load cover image: %w", err)
+	}
+	if err := outFlags.checkCover(*out, algorithm, coverAnimation); err != nil {
+		return err
+	}
+
+	// A plain single file goes into a still image without being read into memory whole
+	if len(coverAnimation.Frames) == 1 && protFlags.plain() && fs.NArg() == 1 {
+		if info, err := os.Stat(fs.Arg(0)); err == nil && info.Mode().IsRegular() {
+			return embedStream(fs.Arg(0), *cover, *out, coverAnimation.Frames[0].Image, algorithm, config, outFlags)
+		}
+	}
+
+	data, err := stego.PackPaths(fs.Args())
+	if err != nil {
+		return fmt.Errorf("failed to load secret data: %w", err)
+	}
+
+	data, err = protFlags.apply(data)
+	if err != nil {
+		return err
+	}
+
+	// Animations carry the payload in pieces spread over their frames
+	if frameCount := len(coverAnimation.Frames); frameCount > 1 {
+		frames, err := stego.EmbedFrames(context.Background(), algorithm, coverAnimation.Images(), data, config, nil)
+		if err != nil {
+			return fmt.Errorf("failed to embed data: %w", err)
+		}
+		if err := imageio.SaveAnimationFormat(*out, coverAnimation.WithImages(frames), outFlags.format); err != nil {
+			return fmt.Errorf("failed to save stego image: %w", err)
+		}
+		err = outFlags.verifySaved(data, func() ([]byte, error) {
+			saved, err := imageio.LoadAnimation(*out)
+			if err != nil {
+				return nil, err
+			}
+			return stego.ExtractFrames(context.Background(), algorithm, saved.Images(), config, nil)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("embedded %d bytes into %d frames of %s\n", len(data), frameCount, *out)
+		return nil
+	}
+	coverImage := coverAnimation.Frames[0].Image
+
+	sealed, err := stego.SealPayload(data)
+	if err != nil {
+		return err
+	}
+
+	stegoImage, err := algorithm.Embed(coverImage, sealed, config)
+	if err != nil {
+		return fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	if err := imageio.SaveWith(*out, stegoImage, outFlags.options(*cover)); err != nil {
+		return fmt.Errorf("failed to save stego image: %w", err)
+	}
+	err = outFlags.verifySaved(sealed, func() ([]byte, error) {
+		saved, err := imageio.Load(*out)
+		if err != nil {
+			return nil, err
+		}
+		return algorithm.Extract(saved, config)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("embedded %d bytes into %s\n", len(data), *out)
+	return nil
+}
+
+// embedStream embeds the regular file at path into the cover image, reading it in chunks
+func embedStream(path, cover, out string, coverImage image.Image, algorithm stego.Steganographer, config stego.Config, outFlags outputFlags) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to load secret data: %w", err)
+	}
+	defer file.Close()
+
+	sealed, err := stego.SealStream(file)
+	if err != nil {
+		return fmt.Errorf("failed to load secret data: %w", err)
+	}
+	digest := sha256.New()
+	counter := &countingReader{r: io.TeeReader(sealed, digest)}
+
+	stegoImage, err := stego.EmbedStream(algorithm, coverImage, counter, config)
+	if err != nil {
+		return fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	if err := imageio.SaveWith(out, stegoImage, outFlags.options(cover)); err != nil {
+		return fmt.Errorf("failed to save stego image: %w", err)
+	}
+	err = outFlags.verifySavedStream(digest.Sum(nil), func(w io.Writer) error {
+		saved, err := imageio.Load(out)
+		if err != nil {
+			return err
+		}
+		return stego.ExtractStream(algorithm, saved, w, config)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("embedded %d bytes into %s\n", counter.n-int64(stego.PayloadHeaderSize), out)
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// loadStego loads the frames of the stego image and the algorithm to read them with,
+// detecting it when asked
+func loadStego(in string, algFlags algorithmFlags, opnFlags openFlags) (stego.Steganographer, stego.Config, []image.Image, error) {
+	algorithm, config, err := algFlags.build()
+	if err != nil {
+		return nil, config, nil, err
+	}
+
+	stegoAnimation, err := imageio.LoadAnimation(in)
+	if err != nil {
+		return nil, config, nil, fmt.Errorf("failed to load stego image: %w", err)
+	}
+	frames := stegoAnimation.Images()
+
+	if algFlags.detect && !opnFlags.deniable {
+		detection, err := stego.DetectFrames(context.Background(), frames, config.Region, algFlags.storedParams(), nil)
+		if err != nil {
+			return nil, config, nil, err
+		}
+		fmt.Fprintln(os.Stderr, "detected", detection)
+
+		algorithm, err = stego.Factory(detection.Algorithm)
+		if err != nil {
+			return nil, config, nil, err
+		}
+		detection.Config.Region = config.Region
+		config = detection.Config
+	}
+
+	return algorithm, config, frames, nil
+}
+
+// extractPayload loads the stego image and returns the hidden payload
+func extractPayload(in string, algFlags algorithmFlags, opnFlags openFlags) ([]byte, error) {
+	algorithm, config, frames, err := loadStego(in, algFlags, opnFlags)
+	if err != nil {
+		return nil, err
+	}
+	return extractFrames(algorithm, config, frames, opnFlags)
+}
+
+// extractFrames returns the payload hidden in the loaded frames of a stego image
+func extractFrames(algorithm stego.Steganographer, config stego.Config, frames []image.Image, opnFlags openFlags) ([]byte, error) {
+	stegoImage := frames[0]
+	if opnFlags.deniable {
+		deniable, ok := algorithm.(stego.DeniableSteganographer)
+		if !ok {
+			return nil, fmt.Errorf("algorithm %s does not support deniable embedding", algorithm.Name())
+		}
+		return deniable.ExtractDeniable(stegoImage, opnFlags.password, config)
+	}
+
+	if len(frames) > 1 {
+		// Reassemble the pieces spread over the frames of an animation
+		data, err := stego.ExtractFrames(context.Background(), algorithm, frames, config, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract data: %w", err)
+		}
+		return opnFlags.apply(data)
+	}
+
+	data, err := algorithm.Extract(stegoImage, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract data: %w", err)
+	}
+
+	data, err = stego.OpenPayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return opnFlags.apply(data)
+}
+
+// writePayload saves a single-file payload to out, or unpacks the selected archive entries into it
+func writePayload(data []byte, out string, entries []string) error {
+	if !stego.IsArchive(data) {
+		if len(entries) > 0 {
+			return errors.New("payload is a single file, entry names are not allowed")
+		}
+		if err := os.WriteFile(out, data, 0644); err != nil {
+			return fmt.Errorf("failed to save extracted data: %w", err)
+		}
+		fmt.Printf("extracted %d bytes to %s\n", len(data), out)
+		return nil
+	}
+
+	written, err := stego.ExtractArchive(data, out, entries)
+	for _, path := range written {
+		fmt.Println(path)
+	}
+	return err
+}
+
+// envelopePeek is the number of leading payload bytes that tell an encrypted, signed or
+// archive payload apart from a plain single file
+const envelopePeek = 1 << 10
+
+// extractStream extracts the payload of a still stego image into a temporary file next to
+// out, so a plain single file is never held in memory whole. Encrypted, signed and archive
+// payloads are read back from the temporary file and opened like extractPayload does.
+func extractStream(algorithm stego.Steganographer, config stego.Config, stegoImage image.Image, opnFlags openFlags, out string, entries []string) error {
+	pattern := "." + filepath.Base(out) + ".*"
+	tmp, err := os.CreateTemp(filepath.Dir(out), pattern)
+	if errors.Is(err, os.ErrNotExist) {
+		// Archives are unpacked into out with the missing parents created
+		tmp, err = os.CreateTemp("", pattern)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save extracted data: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	payload := stego.OpenStream(tmp)
+	if err := stego.ExtractStream(algorithm, stegoImage, payload, config); err != nil {
+		return fmt.Errorf("failed to extract data: %w", err)
+	}
+	if err := payload.Close(); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	head := make([]byte, min(size, envelopePeek))
+	if _, err := io.ReadFull(tmp, head); err != nil {
+		return err
+	}
+
+	if stego.IsEncrypted(head) || stego.IsSigned(head) || stego.IsArchive(head) || opnFlags.keyring != "" {
+		data := make([]byte, size)
+		if _, err := tmp.ReadAt(data, 0); err != nil {
+			return err
+		}
+		data, err = opnFlags.apply(data)
+		if err != nil {
+			return err
+		}
+		return writePayload(data, out, entries)
+	}
+
+	if len(entries) > 0 {
+		return errors.New("payload is a single file, entry names are not allowed")
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to save extracted data: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save extracted data: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return fmt.Errorf("failed to save extracted data: %w", err)
+	}
+	fmt.Printf("extracted %d bytes to %s\n", size, out)
+	return nil
+}
+
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	in := fs.String("in", "", "stego image")
+	out := fs.String("out", "", "output file, or directory for archives")
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	var opnFlags openFlags
+	opnFlags.register(fs)
+	fs.BoolVar(&opnFlags.deniable, "deniable", false, "read an image made by the dual command, -password is the key")
+	fs.BoolVar(&algFlags.detect, "detect", false, "detect the algorithm and fractal parameters")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *in == "" || *out == "" {
+		return errors.New("both -in and -out are required")
+	}
+
+	algorithm, config, frames, err := loadStego(*in, algFlags, opnFlags)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 1 && !opnFlags.deniable {
+		return extractStream(algorithm, config, frames[0], opnFlags, *out, fs.Args())
+	}
+
+	data, err := extractFrames(algorithm, config, frames, opnFlags)
+	if err != nil {
+		return err
+	}
+
+	return writePayload(data, *out, fs.Args())
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	in := fs.String("in", "", "stego image")
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	var opnFlags openFlags
+	opnFlags.register(fs)
+	fs.BoolVar(&opnFlags.deniable, "deniable", false, "read an image made by the dual command, -password is the key")
+	fs.BoolVar(&algFlags.detect, "detect", false, "detect the algorithm and fractal parameters")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	data, err := extractPayload(*in, algFlags, opnFlags)
+	if err != nil {
+		return err
+	}
+
+	if !stego.IsArchive(data) {
+		fmt.Printf("single file, %d bytes\n", len(data))
+		return nil
+	}
+
+	entries, err := stego.ListArchive(data)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%v %10d %s\n", entry.Mode, entry.Size, entry.Name)
+	}
+
+	return nil
+}
+
+func runDetect(args []string) error {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	in := fs.String("in", "", "stego image")
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	stegoAnimation, err := imageio.LoadAnimation(*in)
+	if err != nil {
+		return fmt.Errorf("failed to load stego image: %w", err)
+	}
+
+	region, err := stego.ParseRegion(algFlags.region)
+	if err != nil {
+		return err
+	}
+
+	detection, err := stego.DetectFrames(context.Background(), stegoAnimation.Images(), region, algFlags.storedParams(), nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(detection)
+	return nil
+}
+
+func runSplit(args []string) error {
+	return runMultiCover("split", args)
+}
+
+func runShare(args []string) error {
+	return runMultiCover("share", args)
+}
+
+// runMultiCover spreads the payload over several covers, either as split pieces or as threshold shares
+func runMultiCover(mode string, args []string) error {
+	fs := flag.NewFlagSet(mode, flag.ExitOnError)
+	var covers stringList
+	fs.Var(&covers, "cover", "cover image (repeat for every piece)")
+	out := fs.String("out", "", "output stego image, pieces are numbered after it")
+	var outFlags outputFlags
+	outFlags.register(fs)
+	threshold := 0
+	if mode == "share" {
+		fs.IntVar(&threshold, "k", 2, "number of images required to reconstruct the payload")
+	}
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	var protFlags protectFlags
+	protFlags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if len(covers) == 0 || *out == "" {
+		return errors.New("at least one -cover and -out are required")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no files to embed")
+	}
+	if err := outFlags.check(*out); err != nil {
+		return err
+	}
+
+	algorithm, config, err := algFlags.build()
+	if err != nil {
+		return err
+	}
+	if err := outFlags.checkCover(*out, algorithm, nil); err != nil {
+		return err
+	}
+
+	coverImages := make([]image.Image, len(covers))
+	for i, path := range covers {
+		coverImages[i], err = imageio.Load(path)
+		if err != nil {
+			return fmt.Errorf("failed to load cover image %s: %w", path, err)
+		}
+	}
+
+	data, err := stego.PackPaths(fs.Args())
+	if err != nil {
+		return fmt.Errorf("failed to load secret data: %w", err)
+	}
+
+	data, err = protFlags.apply(data)
+	if err != nil {
+		return err
+	}
+
+	var stegoImages []image.Image
+	if mode == "share" {
+		stegoImages, err = stego.Share(algorithm, coverImages, data, threshold, config)
+	} else {
+		stegoImages, err = stego.Split(algorithm, coverImages, data, config)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s data: %w", mode, err)
+	}
+
+	paths := make([]string, len(stegoImages))
+	for i, img := range stegoImages {
+		paths[i] = stego.PartPath(*out, i+1)
+		if err := imageio.SaveWith(paths[i], img, outFlags.options(covers[i])); err != nil {
+			return fmt.Errorf("failed to save stego image: %w", err)
+		}
+		fmt.Println(paths[i])
+	}
+
+	return outFlags.verifySaved(data, func() ([]byte, error) {
+		saved := make([]image.Image, len(paths))
+		for i, path := range paths {
+			if saved[i], err = imageio.Load(path); err != nil {
+				return nil, err
+			}
+		}
+		return stego.Join(algorithm, saved, config)
+	})
+}
+
+func runJoin(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	out := fs.String("out", "", "output file, or directory for archives")
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	var opnFlags openFlags
+	opnFlags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	paths, entries := fs.Args(), []string(nil)
+	for i, arg := range paths {
+		if arg == "--" {
+			paths, entries = paths[:i], paths[i+1:]
+			break
+		}
+	}
+	if len(paths) == 0 {
+		return errors.New("no stego images to join")
+	}
+
+	algorithm, config, err := algFlags.build()
+	if err != nil {
+		return err
+	}
+
+	images := make([]image.Image, len(paths))
+	for i, path := range paths {
+		images[i], err = imageio.Load(path)
+		if err != nil {
+			return fmt.Errorf("failed to load stego image %s: %w", path, err)
+		}
+	}
+
+	data, err := stego.Join(algorithm, images, config)
+	if err != nil {
+		return fmt.Errorf("failed to join pieces: %w", err)
+	}
+
+	data, err = opnFlags.apply(data)
+	if err != nil {
+		return err
+	}
+
+	return writePayload(data, *out, entries)
+}
+
+// runProfile saves the given options as a profile
+func runProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	out := fs.String("out", "", "output profile, .json or .toml")
+	name := fs.String("name", "", "profile name")
+	mode := fs.String("mode", stego.ModeSingle, "embedding mode: single, split, share or deniable")
+	threshold := fs.Int("k", 0, "share threshold of the share mode")
+	encryption := fs.String("encryption", "", "encryption: none, password or recipients (default from the options)")
+	var recipients stringList
+	fs.Var(&recipients, "recipient", "X25519 public key file of a recipient (repeatable)")
+	signKey := fs.String("sign", "", "Ed25519 private key file for signing")
+	keyring := fs.String("keyring", "", "file or directory of trusted Ed25519 signer public keys")
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	_, config, err := algFlags.build()
+	if err != nil {
+		return err
+	}
+
+	profile, err := stego.NewProfile(*name, algFlags.algorithm, config)
+	if err != nil {
+		return err
+	}
+	profile.Mode = *mode
+	profile.ShareThreshold = *threshold
+	profile.Recipients = recipients
+	profile.SigningKey = *signKey
+	profile.Keyring = *keyring
+	profile.Encryption = *encryption
+	if profile.Encryption == "" && len(recipients) > 0 {
+		profile.Encryption = stego.EncryptionRecipients
+	}
+
+	if err := stego.SaveProfile(*out, profile); err != nil {
+		return err
+	}
+
+	fmt.Printf("saved profile to %s\n", *out)
+	return nil
+}
+
+// runAlgorithms lists the registered algorithms
+func runAlgorithms() {
+	for _, info := range stego.Registered() {
+		fmt.Printf("%-12s %s\n", info.ID, info.DisplayName(stego.DefaultLanguage))
+		if description := info.Description(stego.DefaultLanguage); description != "" {
+			fmt.Printf("%-12s %s\n", "", description)
+		}
+	}
+}
+
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "", "base name of the key files, <name>.key and <name>.pub are written")
+	sign := fs.Bool("sign", false, "generate an Ed25519 signing key instead of an X25519 encryption key")
+	_ = fs.Parse(args)
+
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	var privKey, pubKey any
+	if *sign {
+		key, err := stego.GenerateSigningKey()
+		if err != nil {
+			return err
+		}
+		privKey, pubKey = key, key.Public()
+	} else {
+		key, err := stego.GenerateRecipientKey()
+		if err != nil {
+			return err
+		}
+		privKey, pubKey = key, key.PublicKey()
+	}
+
+	privPEM, err := stego.MarshalPrivateKey(privKey)
+	if err != nil {
+		return err
+	}
+	pubPEM, err := stego.MarshalPublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(*out+".key", privPEM, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out+".pub", pubPEM, 0644); err != nil {
+		return err
+	}
+
+	fmt.Println(*out + ".key")
+	fmt.Println(*out + ".pub")
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	keyPath := fs.String("key", "", "private key file")
+	out := fs.String("out", "", "public key file, standard output if empty")
+	_ = fs.Parse(args)
+
+	if *keyPath == "" {
+		return errors.New("-key is required")
+	}
+
+	var pubKey any
+	if key, err := stego.LoadIdentity(*keyPath); err == nil {
+		pubKey = key.PublicKey()
+	} else if signKey, signErr := stego.LoadSigningKey(*keyPath); signErr == nil {
+		pubKey = signKey.Public()
+	} else {
+		return err
+	}
+
+	pubPEM, err := stego.MarshalPublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(pubPEM)
+		return err
+	}
+	return os.WriteFile(*out, pubPEM, 0644)
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "key as PEM, base64 or hex text, or raw 32 bytes")
+	out := fs.String("out", "", "PEM key file to write")
+	private := fs.Bool("private", false, "the input is a private key")
+	_ = fs.Parse(args)
+
+	if *in == "" || *out == "" {
+		return errors.New("both -in and -out are required")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+
+	if *private {
+		key, err := stego.ParseIdentity(data)
+		if err != nil {
+			return err
+		}
+		privPEM, err := stego.MarshalPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(*out, privPEM, 0600)
+	}
+
+	key, err := stego.ParseRecipientKey(data)
+	if err != nil {
+		return err
+	}
+	pubPEM, err := stego.MarshalPublicKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, pubPEM, 0644)
+}
+
+func runDual(args []string) error {
+	fs := flag.NewFlagSet("dual", flag.ExitOnError)
+	cover := fs.String("cover", "", "cover image")
+	out := fs.String("out", "", "output stego image")
+	decoyKey := fs.String("decoy-password", "", "key that reveals the decoy payload")
+	secretFileFlag(fs, "decoy-password", func(value string) { *decoyKey = value })
+	var hiddenPaths stringList
+	fs.Var(&hiddenPaths, "hidden", "file or directory of the hidden payload (repeatable)")
+	hiddenKey := fs.String("hidden-password", "", "key that reveals the hidden payload")
+	secretFileFlag(fs, "hidden-password", func(value string) { *hiddenKey = value })
+	var outFlags outputFlags
+	outFlags.register(fs)
+	var algFlags algorithmFlags
+	algFlags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *cover == "" || *out == "" || *decoyKey == "" {
+		return errors.New("-cover, -out and -decoy-password or -decoy-password-file are required")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no decoy files to embed")
+	}
+	if len(hiddenPaths) > 0 && *hiddenKey == "" {
+		return errors.New("-hidden-password or -hidden-password-file is required with -hidden")
+	}
+	if err := outFlags.check(*out); err != nil {
+		return err
+	}
+
+	algorithm, config, err := algFlags.build()
+	if err != nil {
+		return err
+	}
+	deniable, ok := algorithm.(stego.DeniableSteganographer)
+	if !ok {
+		return fmt.Errorf("algorithm %s does not support deniable embedding", algorithm.Name())
+	}
+	if err := outFlags.checkCover(*out, algorithm, nil); err != nil {
+		return err
+	}
+
+	coverImage, err := imageio.Load(*cover)
+	if err != nil {
+		return fmt.Errorf("failed to load cover image: %w", err)
+	}
+
+	decoy, err := stego.PackPaths(fs.Args())
+	if err != nil {
+		return fmt.Errorf("failed to load decoy data: %w", err)
+	}
+
+	var hidden []byte
+	if len(hiddenPaths) > 0 {
+		hidden, err = stego.PackPaths(hiddenPaths)
+		if err != nil {
+			return fmt.Errorf("failed to load hidden data: %w", err)
+		}
+	}
+
+	stegoImage, err := deniable.EmbedDeniable(coverImage, decoy, *decoyKey, hidden, *hiddenKey, config)
+	if err != nil {
+		return fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	if err := imageio.SaveWith(*out, stegoImage, outFlags.options(*cover)); err != nil {
+		return fmt.Errorf("failed to save stego image: %w", err)
+	}
+	// Both payloads are checked, each with its own key
+	extractWith := func(key string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			saved, err := imageio.Load(*out)
+			if err != nil {
+				return nil, err
+			}
+			return deniable.ExtractDeniable(saved, key, config)
+		}
+	}
+	if err := outFlags.verifySaved(decoy, extractWith(*decoyKey)); err != nil {
+		return err
+	}
+	if hidden != nil {
+		if err := outFlags.verifySaved(hidden, extractWith(*hiddenKey)); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("embedded %d decoy and %d hidden bytes into %s\n", len(decoy), len(hidden), *out)
+	return nil
+}
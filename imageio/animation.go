@@ -0,0 +1,227 @@
+package imageio
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"os"
+	"time"
+)
+
+// Disposal tells what happens to the area of a frame before the next one is drawn.
+// The values are those of GIF; APNG stores them minus one.
+type Disposal byte
+
+const (
+	// DisposalUnspecified is GIF's default and behaves like DisposalNone
+	DisposalUnspecified Disposal = 0
+	// DisposalNone leaves the frame on the canvas
+	DisposalNone Disposal = gif.DisposalNone
+	// DisposalBackground clears the area of the frame to transparent
+	DisposalBackground Disposal = gif.DisposalBackground
+	// DisposalPrevious restores the area of the frame to what it was before the frame
+	DisposalPrevious Disposal = gif.DisposalPrevious
+)
+
+// Blend tells how a frame is drawn onto the canvas
+type Blend byte
+
+const (
+	// BlendSource replaces the area of the frame, transparent pixels included
+	BlendSource Blend = 0
+	// BlendOver composites the frame over the canvas, as GIF always does
+	BlendOver Blend = 1
+)
+
+// Frame is one image of an animation with its timing and composition
+type Frame struct {
+	// Image is placed on the canvas at its bounds
+	Image image.Image
+	// Delay is how long the frame is shown
+	Delay time.Duration
+	// Disposal applies to the area of the frame once its delay is over
+	Disposal Disposal
+	// Blend is how the frame is drawn; GIF output always blends over
+	Blend Blend
+}
+
+// Animation is a sequence of frames drawn on a canvas, as stored in animated GIF and APNG files
+type Animation struct {
+	// Width and Height are the size of the canvas
+	Width, Height int
+	// Frames holds the frames in display order
+	Frames []Frame
+	// Plays is the number of times the animation is played, 0 meaning forever
+	Plays int
+	// BackgroundIndex is the background color of a GIF
+	BackgroundIndex byte
+}
+
+// Images returns the frame images in display order
+func (a *Animation) Images() []image.Image {
+	images := make([]image.Image, len(a.Frames))
+	for i, frame := range a.Frames {
+		images[i] = frame.Image
+	}
+	return images
+}
+
+// WithImages returns a copy of the animation whose frames show the given images,
+// keeping the timings and composition of the frames
+func (a *Animation) WithImages(images []image.Image) *Animation {
+	out := *a
+	out.Frames = append([]Frame(nil), a.Frames...)
+	for i := range out.Frames {
+		out.Frames[i].Image = images[i]
+	}
+	return &out
+}
+
+// LoadAnimation reads an animated GIF or APNG with all of its frames.
+// Any other image is returned as an animation of one frame.
+func LoadAnimation(path string) (*Animation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return decodeGIF(data)
+	case bytes.HasPrefix(data, []byte(pngSignature)) && isAPNG(data):
+		return decodeAPNG(data)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	return &Animation{Width: b.Max.X, Height: b.Max.Y, Frames: []Frame{{Image: img}}}, nil
+}
+
+// SaveAnimation writes the animation to path: as GIF when the path ends in .gif, otherwise
+// as APNG. GIF output needs paletted frames; APNG output writes a palette only when all
+// frames share one, so payloads of the palette algorithm survive only in GIF output.
+func SaveAnimation(path string, a *Animation) error {
+	return SaveAnimationFormat(path, a, "")
+}
+
+// CheckAnimationOutput is CheckOutput for the stego image made from cover, or from a still
+// image when cover is nil, so that a bad combination is refused before anything is embedded.
+// Covers of several frames need GIF or PNG, the formats storing animations, and GIF needs
+// stego frames that stay paletted, which keepsPalette reports for the algorithm: other
+// algorithms turn paletted frames into true color. Paletted frames keep their indices in
+// APNG only when they share one palette, so the payload of an algorithm keeping the palette
+// cannot be saved as PNG from frames with palettes of their own.
+func CheckAnimationOutput(path, name string, cover *Animation, keepsPalette bool) error {
+	format, err := OutputFormat(path, name)
+	if err != nil {
+		return err
+	}
+	if err := format.usable(); err != nil {
+		return err
+	}
+	if format.PalettedOnly && !keepsPalette {
+		return ErrGIFNotPaletted
+	}
+	if cover == nil || len(cover.Frames) < 2 {
+		return nil
+	}
+
+	switch {
+	case format.Name != "gif" && format.Name != "png":
+		return fmt.Errorf("%s cannot store the %d frames of the cover; save them as GIF or PNG", format.Name, len(cover.Frames))
+	case format.Name == "png" && keepsPalette && chooseFormat(cover.Frames).palette == nil:
+		return fmt.Errorf("%w: the frames of the cover have different palettes, which APNG cannot keep; save them as GIF", ErrLossyFormat)
+	}
+	return nil
+}
+
+// SaveAnimationFormat writes the animation as the named format, or the one given by the
+// extension of path when name is empty. Only GIF and PNG store animations.
+func SaveAnimationFormat(path string, a *Animation, name string) error {
+	format, err := OutputFormat(path, name)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch format.Name {
+	case "gif":
+		err = encodeGIF(&buf, a)
+	case "png":
+		err = encodeAPNG(&buf, a)
+	default:
+		err = fmt.Errorf("%s cannot store animations; save them as GIF or PNG", format.Name)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// decodeGIF reads all frames of a GIF
+func decodeGIF(data []byte) (*Animation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Animation{
+		Width:           g.Config.Width,
+		Height:          g.Config.Height,
+		Frames:          make([]Frame, len(g.Image)),
+		BackgroundIndex: g.BackgroundIndex,
+	}
+	switch g.LoopCount {
+	case -1:
+		a.Plays = 1
+	case 0:
+		a.Plays = 0
+	default:
+		a.Plays = g.LoopCount + 1
+	}
+
+	for i, img := range g.Image {
+		a.Frames[i] = Frame{
+			Image:    img,
+			Delay:    time.Duration(g.Delay[i]) * 10 * time.Millisecond,
+			Disposal: Disposal(g.Disposal[i]),
+			Blend:    BlendOver,
+		}
+	}
+	return a, nil
+}
+
+// encodeGIF writes the animation as GIF, each frame with its own color table
+func encodeGIF(buf *bytes.Buffer, a *Animation) error {
+	g := &gif.GIF{
+		Image:           make([]*image.Paletted, len(a.Frames)),
+		Delay:           make([]int, len(a.Frames)),
+		Disposal:        make([]byte, len(a.Frames)),
+		BackgroundIndex: a.BackgroundIndex,
+		Config:          image.Config{Width: a.Width, Height: a.Height},
+	}
+	switch a.Plays {
+	case 0:
+		g.LoopCount = 0
+	case 1:
+		g.LoopCount = -1
+	default:
+		g.LoopCount = a.Plays - 1
+	}
+
+	for i, frame := range a.Frames {
+		paletted, ok := frame.Image.(*image.Paletted)
+		if !ok {
+			return ErrGIFNotPaletted
+		}
+		g.Image[i] = paletted
+		g.Delay[i] = int((frame.Delay + 5*time.Millisecond) / (10 * time.Millisecond))
+		g.Disposal[i] = byte(frame.Disposal)
+	}
+
+	return gif.EncodeAll(buf, g)
+}
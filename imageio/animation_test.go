@@ -0,0 +1,179 @@
+package imageio
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAnimation returns an animation whose frames have different sizes, positions, timings
+// and disposal methods, all paletted or all NRGBA
+func testAnimation(paletted bool) *Animation {
+	rnd := rand.New(rand.NewSource(1))
+	bounds := []image.Rectangle{
+		image.Rect(0, 0, 40, 30),
+		image.Rect(5, 7, 25, 19),
+		image.Rect(30, 20, 40, 30),
+	}
+	disposals := []Disposal{DisposalNone, DisposalBackground, DisposalPrevious}
+
+	a := &Animation{Width: 40, Height: 30, Plays: 3}
+	for i, b := range bounds {
+		var img image.Image
+		if paletted {
+			p := image.NewPaletted(b, palette.WebSafe)
+			for j := range p.Pix {
+				p.Pix[j] = uint8(rnd.Intn(len(palette.WebSafe)))
+			}
+			img = p
+		} else {
+			n := image.NewNRGBA(b)
+			rnd.Read(n.Pix)
+			img = n
+		}
+		a.Frames = append(a.Frames, Frame{
+			Image:    img,
+			Delay:    time.Duration(i+1) * 70 * time.Millisecond,
+			Disposal: disposals[i],
+			Blend:    BlendOver,
+		})
+	}
+	return a
+}
+
+// assertSameAnimation checks that loaded has the canvas, timings and pixels of saved
+func assertSameAnimation(t *testing.T, saved, loaded *Animation) {
+	t.Helper()
+
+	assert.Equal(t, saved.Width, loaded.Width)
+	assert.Equal(t, saved.Height, loaded.Height)
+	assert.Equal(t, saved.Plays, loaded.Plays)
+	require.Len(t, loaded.Frames, len(saved.Frames))
+
+	for i, frame := range saved.Frames {
+		got := loaded.Frames[i]
+		assert.Equal(t, frame.Delay, got.Delay, "frame %d", i)
+		assert.Equal(t, frame.Disposal, got.Disposal, "frame %d", i)
+		assert.Equal(t, frame.Blend, got.Blend, "frame %d", i)
+
+		b := frame.Image.Bounds()
+		require.Equal(t, b, got.Image.Bounds(), "frame %d", i)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				want := color.NRGBAModel.Convert(frame.Image.At(x, y))
+				require.Equal(t, want, color.NRGBAModel.Convert(got.Image.At(x, y)), "frame %d at %d,%d", i, x, y)
+			}
+		}
+	}
+}
+
+// TestAnimationRoundTrip tests that GIF and APNG keep frame geometry, timings, disposal and pixels
+func TestAnimationRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cases := []struct {
+		name     string
+		paletted bool
+		// partial drops the first frame, so that no frame covers the canvas
+		partial bool
+	}{
+		{"anim.gif", true, false},
+		{"indexed.png", true, false},
+		{"truecolor.png", false, false},
+		{"partial.png", false, true},
+	}
+	for _, tc := range cases {
+		saved := testAnimation(tc.paletted)
+		if tc.partial {
+			saved.Frames = saved.Frames[1:]
+		}
+		path := filepath.Join(dir, tc.name)
+		require.NoError(t, SaveAnimation(path, saved), tc.name)
+
+		loaded, err := LoadAnimation(path)
+		require.NoError(t, err, tc.name)
+		assertSameAnimation(t, saved, loaded)
+		if tc.paletted {
+			assert.IsType(t, &image.Paletted{}, loaded.Frames[1].Image, tc.name)
+		}
+	}
+}
+
+// TestAnimationStill tests that single images load as an animation of one frame and
+// that APNG files still open as plain images
+func TestAnimationStill(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	still := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+	require.NoError(t, Save(filepath.Join(dir, "still.png"), still))
+
+	a, err := LoadAnimation(filepath.Join(dir, "still.png"))
+	require.NoError(t, err)
+	require.Len(t, a.Frames, 1)
+	assert.Equal(t, 8, a.Width)
+
+	require.NoError(t, SaveAnimation(filepath.Join(dir, "anim.png"), testAnimation(false)))
+	img, err := Load(filepath.Join(dir, "anim.png"))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 30), img.Bounds())
+}
+
+// TestAnimationGIFNeedsPalette tests that true-color frames are not quantized into a GIF
+func TestAnimationGIFNeedsPalette(t *testing.T) {
+	t.Parallel()
+
+	err := SaveAnimation(filepath.Join(t.TempDir(), "anim.gif"), testAnimation(false))
+	assert.ErrorIs(t, err, ErrGIFNotPaletted)
+}
+
+// TestCheckAnimationOutput tests that outputs the stego image cannot be saved in are refused up front
+func TestCheckAnimationOutput(t *testing.T) {
+	t.Parallel()
+
+	anim := testAnimation(true)
+	assert.NoError(t, CheckAnimationOutput("out.gif", "", anim, true))
+	assert.NoError(t, CheckAnimationOutput("out.png", "", anim, false))
+	assert.NoError(t, CheckAnimationOutput("out.bin", "", anim, false))
+
+	// Algorithms that do not keep the palette cannot write GIF, animated or not
+	assert.ErrorIs(t, CheckAnimationOutput("out.gif", "", anim, false), ErrGIFNotPaletted)
+	assert.ErrorIs(t, CheckAnimationOutput("out.png", "gif", nil, false), ErrGIFNotPaletted)
+
+	// Only GIF and PNG store animations, while a still image goes anywhere
+	assert.ErrorContains(t, CheckAnimationOutput("out.bmp", "", anim, false), "3 frames")
+	assert.NoError(t, CheckAnimationOutput("out.bmp", "", nil, false))
+	assert.ErrorIs(t, CheckAnimationOutput("out.jpg", "", nil, false), ErrLossyFormat)
+
+	// The frames share a palette, which APNG keeps, until one of them gets its own
+	assert.NoError(t, CheckAnimationOutput("out.png", "", anim, true))
+	own := *anim.Frames[1].Image.(*image.Paletted)
+	own.Palette = palette.Plan9
+	anim.Frames[1].Image = &own
+	assert.ErrorIs(t, CheckAnimationOutput("out.png", "", anim, true), ErrLossyFormat)
+	assert.NoError(t, CheckAnimationOutput("out.gif", "", anim, true))
+}
+
+func TestAnimationFormats(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := SaveAnimation(filepath.Join(dir, "anim.webp"), testAnimation(false))
+	assert.Error(t, err)
+
+	// Unknown extensions get PNG, which stores the animation as APNG
+	path := filepath.Join(dir, "anim.bin")
+	a := testAnimation(false)
+	require.NoError(t, SaveAnimationFormat(path, a, ""))
+	loaded, err := LoadAnimation(path)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Frames, len(a.Frames))
+}
@@ -0,0 +1,491 @@
+package imageio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+// pngSignature starts every PNG file
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngChunk is a chunk of a PNG stream without its length and checksum
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readChunks splits a PNG stream into its chunks up to and including IEND, checking every checksum
+func readChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("png: invalid signature")
+	}
+	data = data[len(pngSignature):]
+
+	var chunks []pngChunk
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, errors.New("png: truncated chunk")
+		}
+		length := binary.BigEndian.Uint32(data)
+		if uint64(length) > uint64(len(data)-12) {
+			return nil, errors.New("png: truncated chunk")
+		}
+		body := data[4 : 8+length]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[8+length:]) {
+			return nil, fmt.Errorf("png: invalid checksum of chunk %q", body[:4])
+		}
+
+		chunk := pngChunk{typ: string(body[:4]), data: body[4:]}
+		chunks = append(chunks, chunk)
+		data = data[12+length:]
+		if chunk.typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// writeChunk appends a chunk with its length and checksum to buf
+func writeChunk(buf *bytes.Buffer, typ string, data []byte) {
+	var head [8]byte
+	binary.BigEndian.PutUint32(head[:4], uint32(len(data)))
+	copy(head[4:], typ)
+	buf.Write(head[:])
+	buf.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write(head[4:])
+	crc.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	buf.Write(sum[:])
+}
+
+// isAPNG reports whether a PNG stream has an animation control chunk before its image data
+func isAPNG(data []byte) bool {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return false
+	}
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+	}
+	return false
+}
+
+// apngFrame collects the control and the image data of an APNG frame
+type apngFrame struct {
+	control []byte
+	data    []byte
+}
+
+// decodeAPNG reads the frames of an APNG. Every frame is decoded as a PNG of its own made
+// of the header chunks of the file and the frame's data; a default image that is not part
+// of the animation is skipped.
+func decodeAPNG(data []byte) (*Animation, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" || len(chunks[0].data) != 13 {
+		return nil, errors.New("apng: missing header")
+	}
+	ihdr := chunks[0].data
+
+	a := &Animation{
+		Width:  int(binary.BigEndian.Uint32(ihdr[0:])),
+		Height: int(binary.BigEndian.Uint32(ihdr[4:])),
+	}
+
+	var header []pngChunk
+	var frames []*apngFrame
+	var current *apngFrame
+	seenData := false
+	for _, chunk := range chunks[1:] {
+		switch chunk.typ {
+		case "acTL":
+			if len(chunk.data) != 8 {
+				return nil, errors.New("apng: invalid animation control")
+			}
+			a.Plays = int(binary.BigEndian.Uint32(chunk.data[4:]))
+		case "fcTL":
+			if len(chunk.data) != 26 {
+				return nil, errors.New("apng: invalid frame control")
+			}
+			current = &apngFrame{control: chunk.data}
+			frames = append(frames, current)
+		case "IDAT":
+			seenData = true
+			// Image data without a frame control before it is a default image outside the animation
+			if current != nil {
+				current.data = append(current.data, chunk.data...)
+			}
+		case "fdAT":
+			if current == nil || len(chunk.data) < 4 {
+				return nil, errors.New("apng: frame data without frame control")
+			}
+			current.data = append(current.data, chunk.data[4:]...)
+		case "IEND":
+		default:
+			if !seenData {
+				header = append(header, chunk)
+			}
+		}
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("apng: no frames")
+	}
+
+	canvas := image.Rect(0, 0, a.Width, a.Height)
+	a.Frames = make([]Frame, len(frames))
+	for i, frame := range frames {
+		c := frame.control
+		width, height := binary.BigEndian.Uint32(c[4:]), binary.BigEndian.Uint32(c[8:])
+		x, y := binary.BigEndian.Uint32(c[12:]), binary.BigEndian.Uint32(c[16:])
+		num, den := binary.BigEndian.Uint16(c[20:]), binary.BigEndian.Uint16(c[22:])
+		if den == 0 {
+			den = 100
+		}
+
+		bounds := image.Rect(int(x), int(y), int(x)+int(width), int(y)+int(height))
+		if bounds.Empty() || !bounds.In(canvas) {
+			return nil, fmt.Errorf("apng: frame %d lies outside the canvas", i+1)
+		}
+
+		var stream bytes.Buffer
+		stream.WriteString(pngSignature)
+		frameHeader := append([]byte(nil), ihdr...)
+		binary.BigEndian.PutUint32(frameHeader[0:], width)
+		binary.BigEndian.PutUint32(frameHeader[4:], height)
+		writeChunk(&stream, "IHDR", frameHeader)
+		for _, chunk := range header {
+			writeChunk(&stream, chunk.typ, chunk.data)
+		}
+		writeChunk(&stream, "IDAT", frame.data)
+		writeChunk(&stream, "IEND", nil)
+
+		img, err := png.Decode(&stream)
+		if err != nil {
+			return nil, fmt.Errorf("apng: frame %d: %w", i+1, err)
+		}
+
+		a.Frames[i] = Frame{
+			Image:    translate(img, bounds.Min),
+			Delay:    time.Duration(num) * time.Second / time.Duration(den),
+			Disposal: Disposal(c[24] + 1),
+			Blend:    Blend(c[25]),
+		}
+	}
+	return a, nil
+}
+
+// translate moves an image decoded at the origin to offset p without copying its pixels
+func translate(img image.Image, p image.Point) image.Image {
+	switch img := img.(type) {
+	case *image.RGBA:
+		img.Rect = img.Rect.Add(p)
+	case *image.NRGBA:
+		img.Rect = img.Rect.Add(p)
+	case *image.RGBA64:
+		img.Rect = img.Rect.Add(p)
+	case *image.NRGBA64:
+		img.Rect = img.Rect.Add(p)
+	case *image.Gray:
+		img.Rect = img.Rect.Add(p)
+	case *image.Gray16:
+		img.Rect = img.Rect.Add(p)
+	case *image.Paletted:
+		img.Rect = img.Rect.Add(p)
+	default:
+		moved := image.NewNRGBA(img.Bounds().Add(p))
+		draw.Draw(moved, moved.Rect, img, img.Bounds().Min, draw.Src)
+		return moved
+	}
+	return img
+}
+
+// apngFormat is the pixel format shared by all frames of an APNG
+type apngFormat struct {
+	// palette is set for indexed output
+	palette color.Palette
+	// deep selects 16-bit samples
+	deep bool
+}
+
+// chooseFormat keeps a palette shared by all frames and otherwise picks 8-bit or, when a
+// frame needs it, 16-bit non-premultiplied color
+func chooseFormat(frames []Frame) apngFormat {
+	var format apngFormat
+	if p, ok := frames[0].Image.(*image.Paletted); ok && len(p.Palette) <= 256 {
+		format.palette = p.Palette
+	}
+	for _, frame := range frames {
+		switch img := frame.Image.(type) {
+		case *image.Paletted:
+			if format.palette != nil && !samePalette(img.Palette, format.palette) {
+				format.palette = nil
+			}
+		case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+			format.palette, format.deep = nil, true
+		default:
+			format.palette = nil
+		}
+	}
+	return format
+}
+
+// samePalette reports whether two palettes hold the same colors in the same order
+func samePalette(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		r1, g1, b1, a1 := a[i].RGBA()
+		r2, g2, b2, a2 := b[i].RGBA()
+		if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+			return false
+		}
+	}
+	return true
+}
+
+// pixels returns the rows of the image in the format and the number of bytes per pixel
+func (f apngFormat) pixels(img image.Image) (pix []byte, stride, bpp int) {
+	b := img.Bounds()
+	switch {
+	case f.palette != nil:
+		p := img.(*image.Paletted)
+		return p.Pix, p.Stride, 1
+	case f.deep:
+		out, ok := img.(*image.NRGBA64)
+		if !ok {
+			out = image.NewNRGBA64(b)
+			draw.Draw(out, b, img, b.Min, draw.Src)
+		}
+		return out.Pix, out.Stride, 8
+	default:
+		out, ok := img.(*image.NRGBA)
+		if !ok {
+			out = image.NewNRGBA(b)
+			draw.Draw(out, b, img, b.Min, draw.Src)
+		}
+		return out.Pix, out.Stride, 4
+	}
+}
+
+// encodeAPNG writes the animation as APNG. The first frame is the default image when it
+// covers the canvas; otherwise it is drawn on an empty canvas as a default image that is
+// not part of the animation, so that every frame keeps its size and position.
+func encodeAPNG(buf *bytes.Buffer, a *Animation) error {
+	if len(a.Frames) == 0 {
+		return errors.New("apng: no frames")
+	}
+	format := chooseFormat(a.Frames)
+	canvas := image.Rect(0, 0, a.Width, a.Height)
+
+	buf.WriteString(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(a.Width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(a.Height))
+	switch {
+	case format.palette != nil:
+		ihdr[8], ihdr[9] = 8, 3
+	case format.deep:
+		ihdr[8], ihdr[9] = 16, 6
+	default:
+		ihdr[8], ihdr[9] = 8, 6
+	}
+	writeChunk(buf, "IHDR", ihdr)
+
+	if format.palette != nil {
+		plte := make([]byte, 0, 3*len(format.palette))
+		trns := make([]byte, 0, len(format.palette))
+		opaque := true
+		for _, c := range format.palette {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			plte = append(plte, n.R, n.G, n.B)
+			trns = append(trns, n.A)
+			opaque = opaque && n.A == 0xFF
+		}
+		writeChunk(buf, "PLTE", plte)
+		if !opaque {
+			writeChunk(buf, "tRNS", trns)
+		}
+	}
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(a.Frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(a.Plays))
+	writeChunk(buf, "acTL", actl)
+
+	first := a.Frames[0].Image
+	if first.Bounds() != canvas {
+		var background draw.Image
+		switch {
+		case format.palette != nil:
+			background = image.NewPaletted(canvas, format.palette)
+		case format.deep:
+			background = image.NewNRGBA64(canvas)
+		default:
+			background = image.NewNRGBA(canvas)
+		}
+		draw.Draw(background, first.Bounds(), first, first.Bounds().Min, draw.Src)
+		data, err := compressRows(background, format)
+		if err != nil {
+			return err
+		}
+		writeChunk(buf, "IDAT", data)
+	}
+
+	seq := uint32(0)
+	for i, frame := range a.Frames {
+		b := frame.Image.Bounds()
+		if !b.In(canvas) {
+			return fmt.Errorf("apng: frame %d lies outside the canvas", i+1)
+		}
+
+		num, den := apngDelay(frame.Delay)
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(b.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(b.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(b.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(b.Min.Y))
+		binary.BigEndian.PutUint16(fctl[20:], num)
+		binary.BigEndian.PutUint16(fctl[22:], den)
+		if frame.Disposal > DisposalUnspecified {
+			fctl[24] = byte(frame.Disposal) - 1
+		}
+		fctl[25] = byte(frame.Blend)
+		writeChunk(buf, "fcTL", fctl)
+		seq++
+
+		data, err := compressRows(frame.Image, format)
+		if err != nil {
+			return err
+		}
+		if i == 0 && b == canvas {
+			writeChunk(buf, "IDAT", data)
+			continue
+		}
+		fdat := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), seq)
+		writeChunk(buf, "fdAT", append(fdat, data...))
+		seq++
+	}
+
+	writeChunk(buf, "IEND", nil)
+	return nil
+}
+
+// apngDelay converts a frame delay into the fraction stored in a frame control,
+// in hundredths of a second when that is exact and otherwise in milliseconds
+func apngDelay(d time.Duration) (num, den uint16) {
+	const maxDelay = 1<<16 - 1
+	if cs := d / (10 * time.Millisecond); d%(10*time.Millisecond) == 0 && cs <= maxDelay {
+		return uint16(cs), 100
+	}
+	if ms := d / time.Millisecond; ms <= maxDelay {
+		return uint16(ms), 1000
+	}
+	return uint16(min(d/time.Second, maxDelay)), 1
+}
+
+// compressRows converts the image to the format, filters every row with the PNG filter that
+// minimizes the sum of absolute differences, as the standard encoder does, and compresses
+// the result with zlib
+func compressRows(img image.Image, format apngFormat) ([]byte, error) {
+	pix, stride, bpp := format.pixels(img)
+	width, rows := img.Bounds().Dx()*bpp, img.Bounds().Dy()
+
+	var out bytes.Buffer
+	zw := zlib.NewWriter(&out)
+
+	prev := make([]byte, width)
+	var filtered [5][]byte
+	for i := range filtered {
+		filtered[i] = make([]byte, width+1)
+		filtered[i][0] = byte(i)
+	}
+	for y := 0; y < rows; y++ {
+		row := pix[y*stride : y*stride+width]
+		best := filterRow(row, prev, bpp, &filtered)
+		if _, err := zw.Write(filtered[best]); err != nil {
+			return nil, err
+		}
+		prev = row
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// filterRow applies the five PNG filters to the row and returns the one to keep
+func filterRow(row, prev []byte, bpp int, filtered *[5][]byte) int {
+	for i, x := range row {
+		var a, c byte
+		if i >= bpp {
+			a, c = row[i-bpp], prev[i-bpp]
+		}
+		b := prev[i]
+		filtered[0][i+1] = x
+		filtered[1][i+1] = x - a
+		filtered[2][i+1] = x - b
+		filtered[3][i+1] = x - byte((int(a)+int(b))/2)
+		filtered[4][i+1] = x - paeth(a, b, c)
+	}
+
+	best, bestSum := 0, -1
+	for f := range filtered {
+		sum := 0
+		for _, v := range filtered[f][1:] {
+			sum += abs8(v)
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = f, sum
+		}
+	}
+	return best
+}
+
+// paeth is the Paeth predictor of the PNG specification
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+// abs8 returns the magnitude of a filtered byte read as a signed value
+func abs8(v byte) int {
+	return absInt(int(int8(v)))
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
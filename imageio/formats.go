@@ -0,0 +1,207 @@
+package imageio
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Format describes an image file format and what its encoder keeps of an image.
+// Decoders are registered with the image package, so Load reads every listed format.
+type Format struct {
+	// Name identifies the format on the command line
+	Name string
+	// Extensions lists the file name extensions of the format, the usual one first
+	Extensions []string
+	// Lossy formats discard detail when encoding and never keep a payload
+	Lossy bool
+	// Deep formats keep 16-bit samples
+	Deep bool
+	// Alpha formats keep the transparency of true-color images
+	Alpha bool
+	// Palette formats keep the palette and the color indices of paletted images
+	Palette bool
+	// PalettedOnly formats store nothing but paletted images without quantizing them
+	PalettedOnly bool
+
+	encode func(w io.Writer, img image.Image) error
+}
+
+// Writable reports whether images can be saved in the format
+func (f Format) Writable() bool {
+	return f.encode != nil
+}
+
+// formats lists the supported formats; the first one is used for unknown extensions
+var formats = []Format{
+	{
+		Name: "png", Extensions: []string{".png", ".apng"},
+		Deep: true, Alpha: true, Palette: true,
+		encode: png.Encode,
+	},
+	{
+		Name: "gif", Extensions: []string{".gif"},
+		Alpha: true, Palette: true, PalettedOnly: true,
+		encode: func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) },
+	},
+	{
+		// The encoder writes alpha, but the decoder of its header version ignores it
+		Name: "bmp", Extensions: []string{".bmp"},
+		Palette: true,
+		encode:  bmp.Encode,
+	},
+	{
+		Name: "tiff", Extensions: []string{".tiff", ".tif"},
+		Deep: true, Alpha: true, Palette: true,
+		encode: func(w io.Writer, img image.Image) error {
+			return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+		},
+	},
+	{
+		Name: "pnm", Extensions: []string{".ppm", ".pgm", ".pnm"},
+		Deep:   true,
+		encode: encodePNM,
+	},
+	{
+		Name: "webp", Extensions: []string{".webp"},
+		Alpha:  true,
+		encode: encodeWebP,
+	},
+	{
+		Name: "jpeg", Extensions: []string{".jpg", ".jpeg"},
+		Lossy: true,
+	},
+}
+
+// Formats returns the supported formats
+func Formats() []Format {
+	return append([]Format(nil), formats...)
+}
+
+// formatNames returns the names of the formats, only the writable lossless ones if writable is set
+func formatNames(writable bool) []string {
+	var names []string
+	for _, f := range formats {
+		if !writable || f.Writable() && !f.Lossy {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// WritableFormats returns the names of the formats images can be saved in without losing the payload
+func WritableFormats() []string {
+	return formatNames(true)
+}
+
+// LookupFormat finds a format by its name or by one of its extensions, with or without the dot
+func LookupFormat(name string) (Format, bool) {
+	name = strings.ToLower(name)
+	for _, f := range formats {
+		if f.Name == name {
+			return f, true
+		}
+		for _, ext := range f.Extensions {
+			if ext == name || ext[1:] == name {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// OutputFormat picks the format an image is saved in: the named one, or the one given by
+// the extension of path when name is empty, falling back to PNG for unknown extensions
+func OutputFormat(path, name string) (Format, error) {
+	if name != "" {
+		f, ok := LookupFormat(name)
+		if !ok {
+			return Format{}, fmt.Errorf("unknown image format %q; use one of %s", name, strings.Join(WritableFormats(), ", "))
+		}
+		return f, nil
+	}
+
+	if f, ok := LookupFormat(filepath.Ext(path)); ok && filepath.Ext(path) != "" {
+		return f, nil
+	}
+	return formats[0], nil
+}
+
+// CheckOutput returns an error wrapping ErrLossyFormat when a stego image saved to path in the
+// named format, or the one given by the extension of path, would lose its payload. Every
+// algorithm keeps the payload in exact pixel values, so lossy formats are refused before
+// anything is embedded.
+func CheckOutput(path, name string) error {
+	format, err := OutputFormat(path, name)
+	if err != nil {
+		return err
+	}
+	return format.usable()
+}
+
+// usable returns an error when no image can be saved in the format without losing the payload
+func (f Format) usable() error {
+	if f.Lossy {
+		return fmt.Errorf("%w: %s is a lossy format; use one of %s",
+			ErrLossyFormat, f.Name, strings.Join(WritableFormats(), ", "))
+	}
+	if !f.Writable() {
+		return fmt.Errorf("%s images can be read but not written", f.Name)
+	}
+	return nil
+}
+
+// check returns an error wrapping ErrLossyFormat when saving img in the format would change
+// the pixels that carry the payload
+func (f Format) check(img image.Image) error {
+	if err := f.usable(); err != nil {
+		return err
+	}
+
+	_, paletted := img.(*image.Paletted)
+	switch {
+	case f.PalettedOnly && !paletted:
+		return ErrGIFNotPaletted
+	case paletted && !f.Palette:
+		return fmt.Errorf("%w: %s cannot store the palette of the image", ErrLossyFormat, f.Name)
+	case isDeep(img) && !f.Deep:
+		return fmt.Errorf("%w: %s cannot store 16-bit samples", ErrLossyFormat, f.Name)
+	case !isOpaque(img) && !f.Alpha:
+		return fmt.Errorf("%w: %s cannot store transparency", ErrLossyFormat, f.Name)
+	}
+	return nil
+}
+
+// isDeep reports whether the image has 16-bit samples
+func isDeep(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// isOpaque reports whether every pixel of the image is fully opaque
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
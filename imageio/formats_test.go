@@ -0,0 +1,173 @@
+package imageio
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomImage fills an image of the given kind with noise, so that every least significant bit matters
+func randomImage(kind string, seed int64) image.Image {
+	rnd := rand.New(rand.NewSource(seed))
+	rect := image.Rect(0, 0, 37, 23)
+	switch kind {
+	case "nrgba":
+		img := image.NewNRGBA(rect)
+		rnd.Read(img.Pix)
+		for i := 3; i < len(img.Pix); i += 4 {
+			// Fully transparent pixels lose their color in every format
+			img.Pix[i] = max(img.Pix[i], 1)
+		}
+		return img
+	case "rgb":
+		img := image.NewNRGBA(rect)
+		rnd.Read(img.Pix)
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 0xFF
+		}
+		return img
+	case "rgb16":
+		img := image.NewRGBA64(rect)
+		rnd.Read(img.Pix)
+		for i := 6; i < len(img.Pix); i += 8 {
+			img.Pix[i], img.Pix[i+1] = 0xFF, 0xFF
+		}
+		return img
+	case "gray":
+		img := image.NewGray(rect)
+		rnd.Read(img.Pix)
+		return img
+	case "gray16":
+		img := image.NewGray16(rect)
+		rnd.Read(img.Pix)
+		return img
+	}
+	panic("unknown image kind " + kind)
+}
+
+// assertSamePixels checks that two images have the same bounds and the same 16-bit non-premultiplied colors
+func assertSamePixels(t *testing.T, want, got image.Image) {
+	t.Helper()
+
+	require.Equal(t, want.Bounds(), got.Bounds())
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			w := color.NRGBA64Model.Convert(want.At(x, y))
+			g := color.NRGBA64Model.Convert(got.At(x, y))
+			if w != g {
+				t.Fatalf("pixel (%d, %d): want %v, got %v", x, y, w, g)
+			}
+		}
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	cases := []struct {
+		file string
+		kind string
+	}{
+		{"color.bmp", "rgb"},
+		{"gray.bmp", "gray"},
+		{"alpha.tiff", "nrgba"},
+		{"deep.tif", "rgb16"},
+		{"color.ppm", "rgb"},
+		{"deep.ppm", "rgb16"},
+		{"gray.pgm", "gray"},
+		{"deep.pgm", "gray16"},
+		{"alpha.webp", "nrgba"},
+		{"color.webp", "rgb"},
+		{"gray.webp", "gray"},
+	}
+
+	dir := t.TempDir()
+	for i, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			path := filepath.Join(dir, c.file)
+			img := randomImage(c.kind, int64(i))
+			require.NoError(t, Save(path, img))
+
+			loaded, err := Load(path)
+			require.NoError(t, err)
+			assertSamePixels(t, img, loaded)
+		})
+	}
+}
+
+func TestWebPFlatImage(t *testing.T) {
+	// A single color gives codes of one symbol, which take no bits
+	img := image.NewNRGBA(image.Rect(0, 0, 300, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	path := filepath.Join(t.TempDir(), "flat.webp")
+	require.NoError(t, Save(path, img))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assertSamePixels(t, img, loaded)
+}
+
+func TestPNMPlain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.ppm")
+	require.NoError(t, os.WriteFile(path, []byte("P3\n# two pixels\n2 1\n15\n15 0 0  0 7 15\n"), 0644))
+
+	img, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0xFF, A: 0xFF}, img.At(0, 0))
+	assert.Equal(t, color.RGBA{G: 0x77, B: 0xFF, A: 0xFF}, img.At(1, 0))
+}
+
+func TestSaveRefusesLossyFormats(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		file   string
+		format string
+		kind   string
+	}{
+		{"out.jpg", "", "rgb"},
+		{"out.png", "jpeg", "rgb"},
+		{"out.bmp", "", "rgb16"},
+		{"alpha.bmp", "", "nrgba"},
+		{"out.webp", "", "gray16"},
+		{"out.ppm", "", "nrgba"},
+		{"out.gif", "", "rgb"},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(dir, c.file)
+		err := SaveFormat(path, randomImage(c.kind, 1), c.format)
+		assert.ErrorIs(t, err, ErrLossyFormat, c.file)
+		assert.NoFileExists(t, path)
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	cases := []struct {
+		path, name, want string
+	}{
+		{"a.PNG", "", "png"},
+		{"a.tif", "", "tiff"},
+		{"a.pgm", "", "pnm"},
+		{"a.jpeg", "", "jpeg"},
+		{"a.unknown", "", "png"},
+		{"noext", "", "png"},
+		{"a.png", "webp", "webp"},
+		{"a.png", ".BMP", "bmp"},
+	}
+	for _, c := range cases {
+		f, err := OutputFormat(c.path, c.name)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, f.Name, c.path)
+	}
+
+	_, err := OutputFormat("a.png", "xcf")
+	assert.Error(t, err)
+	assert.NotContains(t, WritableFormats(), "jpeg")
+}
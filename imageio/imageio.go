@@ -0,0 +1,84 @@
+package imageio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+)
+
+// ErrLossyFormat is returned when an image is saved in a format that would destroy the payload
+var ErrLossyFormat = errors.New("output format would destroy the payload")
+
+// ErrGIFNotPaletted is returned when an image without a palette is saved as GIF. The GIF
+// encoder would quantize it and destroy the least significant bits that carry the payload.
+var ErrGIFNotPaletted = fmt.Errorf("%w: only paletted images can be saved as GIF; use the palette algorithm or save as PNG", ErrLossyFormat)
+
+// Load reads and decodes the image stored at path in any of the registered formats
+func Load(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	img, _, err := image.Decode(file)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("%w; supported formats are %s", err, strings.Join(formatNames(false), ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// Save encodes img in the format given by the extension of path, PNG for unknown extensions
+func Save(path string, img image.Image) error {
+	return SaveFormat(path, img, "")
+}
+
+// SaveFormat encodes img in the named format, or in the format given by the extension of
+// path when name is empty, and writes it to path. Nothing is written when the format would
+// destroy the payload.
+func SaveFormat(path string, img image.Image, name string) error {
+	return SaveWith(path, img, SaveOptions{Format: name})
+}
+
+// SaveOptions controls how a stego image is written
+type SaveOptions struct {
+	// Format is the name of the output format; when empty it is given by the extension of the path
+	Format string
+	// Cover is the path of the cover image. When both are PNG, the ancillary chunks of the
+	// cover such as gAMA, iCCP, pHYs and tEXt are copied into the stego image.
+	Cover string
+	// Compression is the zlib level of PNG output
+	Compression Compression
+}
+
+// SaveWith encodes img as the options ask and writes it to path. Nothing is written when the
+// format would destroy the payload.
+func SaveWith(path string, img image.Image, opts SaveOptions) error {
+	format, err := OutputFormat(path, opts.Format)
+	if err != nil {
+		return err
+	}
+	if err := format.check(img); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if format.Name == "png" {
+		err = encodePNG(&buf, img, opts)
+	} else {
+		err = format.encode(&buf, img)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,227 @@
+package imageio
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Compression selects the zlib level of PNG output
+type Compression int
+
+const (
+	// CompressionCover uses the level the cover PNG was written with, or the default without one
+	CompressionCover Compression = iota
+	// CompressionDefault is the level of the standard encoder
+	CompressionDefault
+	// CompressionNone stores the image data without compressing it
+	CompressionNone
+	// CompressionFast favours speed over size
+	CompressionFast
+	// CompressionBest favours size over speed
+	CompressionBest
+)
+
+var compressionNames = []string{"cover", "default", "none", "fast", "best"}
+
+func (c Compression) String() string {
+	if c < 0 || int(c) >= len(compressionNames) {
+		return fmt.Sprintf("Compression(%d)", int(c))
+	}
+	return compressionNames[c]
+}
+
+// CompressionNames returns the names accepted by ParseCompression
+func CompressionNames() []string {
+	return append([]string(nil), compressionNames...)
+}
+
+// ParseCompression returns the compression with the given name
+func ParseCompression(name string) (Compression, error) {
+	for i, n := range compressionNames {
+		if strings.EqualFold(n, name) {
+			return Compression(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown compression %q; use one of %s", name, strings.Join(compressionNames, ", "))
+}
+
+// level returns the encoder level, looking at the image data of the cover for CompressionCover
+func (c Compression) level(cover []pngChunk) png.CompressionLevel {
+	switch c {
+	case CompressionNone:
+		return png.NoCompression
+	case CompressionFast:
+		return png.BestSpeed
+	case CompressionBest:
+		return png.BestCompression
+	case CompressionCover:
+		return coverLevel(cover)
+	}
+	return png.DefaultCompression
+}
+
+// coverLevel guesses the level the cover was compressed with from the zlib header of its
+// image data, which records one of four level classes. In the fastest class a first
+// deflate block that is stored rather than compressed points to no compression at all.
+func coverLevel(cover []pngChunk) png.CompressionLevel {
+	for _, chunk := range cover {
+		if chunk.typ != "IDAT" || len(chunk.data) < 3 {
+			continue
+		}
+		switch chunk.data[1] >> 6 {
+		case 0:
+			if chunk.data[2]>>1&3 == 0 {
+				return png.NoCompression
+			}
+			return png.BestSpeed
+		case 1:
+			return png.BestSpeed
+		case 3:
+			return png.BestCompression
+		}
+		return png.DefaultCompression
+	}
+	return png.DefaultCompression
+}
+
+// copiedChunks lists the ancillary chunks known to stay valid when the pixels change by a
+// least significant bit. Unknown ancillary chunks are copied when their name marks them safe
+// to copy, as the PNG specification asks of editors.
+var copiedChunks = map[string]bool{
+	"gAMA": true, "cHRM": true, "mDCV": true, "cLLI": true,
+	"pHYs": true, "oFFs": true, "sCAL": true, "sPLT": true,
+	"tEXt": true, "zTXt": true, "iTXt": true, "tIME": true, "eXIf": true,
+}
+
+// formatChunks describe samples in the bit depth and color type of the image, so they are
+// copied only when the stego image keeps both. The others are written by the encoder or
+// describe the palette or the animation and are never copied.
+var formatChunks = map[string]bool{"bKGD": true, "sBIT": true}
+
+// colorChunks describe a grayscale or a color space, so they are copied only when the stego
+// image stays on the same side: an ICC profile must be a gray one in grayscale images and
+// an RGB one otherwise. An image must not have both iCCP and sRGB, so sRGB is dropped when
+// the profile is copied.
+var colorChunks = map[string]bool{"iCCP": true, "sRGB": true, "cICP": true}
+
+// copyChunk reports whether a chunk of the cover belongs in the stego image
+func copyChunk(typ string, sameFormat, sameColor bool) bool {
+	switch {
+	case copiedChunks[typ]:
+		return true
+	case formatChunks[typ]:
+		return sameFormat
+	case colorChunks[typ]:
+		return sameColor
+	case typ == "tRNS" || typ == "hIST" || typ == "acTL" || typ == "fcTL" || typ == "fdAT":
+		return false
+	}
+	// Bit 5 of the first letter marks ancillary chunks, that of the last one safe-to-copy chunks
+	return typ[0]&0x20 != 0 && typ[3]&0x20 != 0
+}
+
+// readCoverChunks returns the chunks of the cover when it is a PNG, and nothing otherwise
+func readCoverChunks(path string) ([]pngChunk, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, nil
+	}
+	return readChunks(data)
+}
+
+// encodePNG writes the image as PNG at the requested compression and copies the ancillary
+// chunks of the cover, keeping each on the same side of the palette and the image data
+func encodePNG(w io.Writer, img image.Image, opts SaveOptions) error {
+	cover, err := readCoverChunks(opts.Cover)
+	if err != nil {
+		return fmt.Errorf("failed to read the chunks of the cover: %w", err)
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: opts.Compression.level(cover)}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return err
+	}
+	if len(cover) == 0 {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+
+	out, err := readChunks(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// The chunks point into buf, so the file is assembled in a buffer of its own
+	var merged bytes.Buffer
+	merged.WriteString(pngSignature)
+	for _, chunk := range mergeChunks(out, cover) {
+		writeChunk(&merged, chunk.typ, chunk.data)
+	}
+	_, err = w.Write(merged.Bytes())
+	return err
+}
+
+// mergeChunks inserts the copied chunks of the cover into the chunks of the encoded image.
+// Chunks before the palette of the cover go right after the header, those between the
+// palette and the image data right before the image data, and the rest before the end.
+func mergeChunks(out, cover []pngChunk) []pngChunk {
+	// Bytes 8 and 9 of the header are the bit depth and the color type, whose bit 1 is set
+	// for color images and clear for grayscale ones
+	valid := len(out[0].data) >= 10 && len(cover[0].data) >= 10
+	sameFormat := valid && bytes.Equal(out[0].data[8:10], cover[0].data[8:10])
+	sameColor := valid && out[0].data[9]&2 == cover[0].data[9]&2
+	profile := sameColor && slices.ContainsFunc(cover, func(chunk pngChunk) bool { return chunk.typ == "iCCP" })
+
+	var beforePalette, beforeData, afterData []pngChunk
+	palette, data := false, false
+	for _, chunk := range cover[1:] {
+		switch chunk.typ {
+		case "PLTE":
+			palette = true
+			continue
+		case "IDAT":
+			data = true
+			continue
+		}
+		if !copyChunk(chunk.typ, sameFormat, sameColor) || chunk.typ == "sRGB" && profile {
+			continue
+		}
+		switch {
+		case data:
+			afterData = append(afterData, chunk)
+		case palette:
+			beforeData = append(beforeData, chunk)
+		default:
+			beforePalette = append(beforePalette, chunk)
+		}
+	}
+
+	merged := make([]pngChunk, 0, len(out)+len(beforePalette)+len(beforeData)+len(afterData))
+	merged = append(merged, out[0])
+	merged = append(merged, beforePalette...)
+	inserted := false
+	for _, chunk := range out[1:] {
+		switch {
+		case chunk.typ == "IDAT" && !inserted:
+			merged = append(merged, beforeData...)
+			inserted = true
+		case chunk.typ == "IEND":
+			merged = append(merged, afterData...)
+		}
+		merged = append(merged, chunk)
+	}
+	return merged
+}
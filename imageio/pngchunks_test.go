@@ -0,0 +1,221 @@
+package imageio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smoothImage returns an opaque gradient, which every compression level compresses
+func smoothImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(4 * x), G: uint8(5 * y), B: 0x80, A: 0xFF})
+		}
+	}
+	return img
+}
+
+// writeCover saves the image as PNG at the level and adds ancillary chunks around its palette
+// and image data: some that are always copied, some that depend on the format, and private ones
+func writeCover(t *testing.T, path string, img image.Image, level png.CompressionLevel) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: level}
+	require.NoError(t, encoder.Encode(&buf, img))
+	chunks, err := readChunks(buf.Bytes())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	firstData := true
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "IDAT":
+			// Only the first image data chunk is preceded by the chunks below
+			if firstData {
+				firstData = false
+				writeChunk(&out, "pHYs", []byte{0, 0, 0x0B, 0x13, 0, 0, 0x0B, 0x13, 1})
+				writeChunk(&out, "sBIT", []byte{8, 8, 8})
+			}
+		case "IEND":
+			writeChunk(&out, "tIME", []byte{0x07, 0xE8, 1, 2, 3, 4, 5})
+			writeChunk(&out, "tEXt", []byte("Comment\x00after the image data"))
+		}
+		writeChunk(&out, chunk.typ, chunk.data)
+		if chunk.typ == "IHDR" {
+			writeChunk(&out, "gAMA", []byte{0, 0, 0xB1, 0x8F})
+			writeChunk(&out, "tEXt", []byte("Software\x00cover encoder"))
+			writeChunk(&out, "prVt", []byte("safe to copy"))
+			writeChunk(&out, "prVT", []byte("unsafe to copy"))
+		}
+	}
+	require.NoError(t, os.WriteFile(path, out.Bytes(), 0644))
+}
+
+// chunkTypes reads the file and returns the types of its chunks, collapsing runs of image data
+func chunkTypes(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	chunks, err := readChunks(data)
+	require.NoError(t, err)
+
+	var types []string
+	for _, chunk := range chunks {
+		if chunk.typ == "IDAT" && types[len(types)-1] == "IDAT" {
+			continue
+		}
+		types = append(types, chunk.typ)
+	}
+	return types
+}
+
+func TestPNGChunksCopied(t *testing.T) {
+	dir := t.TempDir()
+	cover := filepath.Join(dir, "cover.png")
+	writeCover(t, cover, randomImage("rgb", 3), png.DefaultCompression)
+
+	// The stego image keeps the 8-bit RGB format of the cover, so sBIT stays valid
+	path := filepath.Join(dir, "stego.png")
+	img := randomImage("rgb", 4)
+	require.NoError(t, SaveWith(path, img, SaveOptions{Cover: cover}))
+	assert.Equal(t, []string{"IHDR", "gAMA", "tEXt", "prVt", "pHYs", "sBIT", "IDAT", "tIME", "tEXt", "IEND"},
+		chunkTypes(t, path))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assertSamePixels(t, img, loaded)
+
+	// A grayscale stego image cannot use the RGB significant bits of the cover
+	require.NoError(t, SaveWith(path, randomImage("gray", 4), SaveOptions{Cover: cover}))
+	assert.NotContains(t, chunkTypes(t, path), "sBIT")
+
+	// Without a PNG cover the standard encoder output is written
+	require.NoError(t, SaveWith(path, img, SaveOptions{}))
+	assert.Equal(t, []string{"IHDR", "IDAT", "IEND"}, chunkTypes(t, path))
+}
+
+// grayAlphaCover writes an 8-bit gray+alpha PNG, which the standard encoder never produces,
+// with a grayscale ICC profile
+func grayAlphaCover(t *testing.T, path string) {
+	t.Helper()
+
+	const width, height = 16, 8
+	var raw bytes.Buffer
+	for y := 0; y < height; y++ {
+		raw.WriteByte(0)
+		for x := 0; x < width; x++ {
+			raw.Write([]byte{uint8(16 * x), uint8(255 - y)})
+		}
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, err := zw.Write(raw.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	header := binary.BigEndian.AppendUint32(nil, width)
+	header = binary.BigEndian.AppendUint32(header, height)
+	header = append(header, 8, 4, 0, 0, 0)
+
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	writeChunk(&out, "IHDR", header)
+	writeChunk(&out, "iCCP", append([]byte("gray\x00\x00"), compressed.Bytes()...))
+	writeChunk(&out, "gAMA", []byte{0, 0, 0xB1, 0x8F})
+	writeChunk(&out, "IDAT", compressed.Bytes())
+	writeChunk(&out, "IEND", nil)
+	require.NoError(t, os.WriteFile(path, out.Bytes(), 0644))
+}
+
+// TestPNGColorProfile tests that the ICC profile of a grayscale cover is not copied into a
+// color stego image, which the specification forbids, and is kept while the image stays gray
+func TestPNGColorProfile(t *testing.T) {
+	dir := t.TempDir()
+	cover := filepath.Join(dir, "cover.png")
+	grayAlphaCover(t, cover)
+
+	// Gray+alpha decodes as NRGBA, which is written as RGBA
+	img, err := Load(cover)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "stego.png")
+	require.NoError(t, SaveWith(path, img, SaveOptions{Cover: cover}))
+	assert.Equal(t, []string{"IHDR", "gAMA", "IDAT", "IEND"}, chunkTypes(t, path))
+
+	require.NoError(t, SaveWith(path, randomImage("gray", 5), SaveOptions{Cover: cover}))
+	assert.Equal(t, []string{"IHDR", "iCCP", "gAMA", "IDAT", "IEND"}, chunkTypes(t, path))
+}
+
+// TestPNGColorSpaceChunks tests that sRGB and cICP follow the color class like iCCP, and
+// that sRGB is dropped next to a copied ICC profile, which the specification forbids
+func TestPNGColorSpaceChunks(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, randomImage("rgb", 6)))
+	chunks, err := readChunks(buf.Bytes())
+	require.NoError(t, err)
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	for _, chunk := range chunks {
+		writeChunk(&out, chunk.typ, chunk.data)
+		if chunk.typ == "IHDR" {
+			writeChunk(&out, "cICP", []byte{1, 13, 0, 1})
+			writeChunk(&out, "iCCP", []byte("rgb\x00\x00\x78\x9c\x03\x00\x00\x00\x00\x01"))
+			writeChunk(&out, "sRGB", []byte{0})
+		}
+	}
+	cover := filepath.Join(dir, "cover.png")
+	require.NoError(t, os.WriteFile(cover, out.Bytes(), 0644))
+
+	path := filepath.Join(dir, "stego.png")
+	require.NoError(t, SaveWith(path, randomImage("rgb", 7), SaveOptions{Cover: cover}))
+	assert.Equal(t, []string{"IHDR", "cICP", "iCCP", "IDAT", "IEND"}, chunkTypes(t, path))
+
+	require.NoError(t, SaveWith(path, randomImage("gray", 7), SaveOptions{Cover: cover}))
+	assert.Equal(t, []string{"IHDR", "IDAT", "IEND"}, chunkTypes(t, path))
+}
+
+func TestPNGCompressionLevel(t *testing.T) {
+	dir := t.TempDir()
+	read := func(path string) []pngChunk {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		chunks, err := readChunks(data)
+		require.NoError(t, err)
+		return chunks
+	}
+
+	for _, level := range []png.CompressionLevel{png.NoCompression, png.BestSpeed, png.DefaultCompression, png.BestCompression} {
+		cover := filepath.Join(dir, "cover.png")
+		writeCover(t, cover, smoothImage(), level)
+		assert.Equal(t, level, coverLevel(read(cover)))
+
+		// The stego image is compressed like its cover
+		path := filepath.Join(dir, "stego.png")
+		require.NoError(t, SaveWith(path, smoothImage(), SaveOptions{Cover: cover}))
+		assert.Equal(t, level, coverLevel(read(path)))
+
+		require.NoError(t, SaveWith(path, smoothImage(), SaveOptions{Cover: cover, Compression: CompressionNone}))
+		assert.Equal(t, png.NoCompression, coverLevel(read(path)))
+	}
+
+	c, err := ParseCompression("Best")
+	require.NoError(t, err)
+	assert.Equal(t, CompressionBest, c)
+	_, err = ParseCompression("max")
+	assert.Error(t, err)
+}
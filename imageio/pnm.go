@@ -0,0 +1,255 @@
+package imageio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+func init() {
+	for _, magic := range []string{"P2", "P3", "P5", "P6"} {
+		image.RegisterFormat("pnm", magic, decodePNM, decodePNMConfig)
+	}
+}
+
+// pnmHeader is the header of a Netpbm graymap or pixmap
+type pnmHeader struct {
+	// magic is one of P2 and P5 for graymaps, P3 and P6 for pixmaps; P2 and P3 are plain text
+	magic         string
+	width, height int
+	maxval        int
+}
+
+// gray reports whether the image has one sample per pixel
+func (h pnmHeader) gray() bool {
+	return h.magic == "P2" || h.magic == "P5"
+}
+
+// deep reports whether the samples need 16 bits
+func (h pnmHeader) deep() bool {
+	return h.maxval > 0xFF
+}
+
+// readPNMToken returns the next whitespace-separated token, skipping comments.
+// The whitespace character ending the token is consumed.
+func readPNMToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && len(token) > 0 {
+			return string(token), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '#' && len(token) == 0:
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, c)
+		}
+	}
+}
+
+// readPNMNumber reads a non-negative decimal token
+func readPNMNumber(r *bufio.Reader) (int, error) {
+	token, err := readPNMToken(r)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(token)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("pnm: invalid number %q", token)
+	}
+	return n, nil
+}
+
+// readPNMHeader reads the header up to and including the whitespace before the raster
+func readPNMHeader(r *bufio.Reader) (pnmHeader, error) {
+	var h pnmHeader
+	magic, err := readPNMToken(r)
+	if err != nil {
+		return h, err
+	}
+	if magic != "P2" && magic != "P3" && magic != "P5" && magic != "P6" {
+		return h, errors.New("pnm: unsupported format " + magic)
+	}
+	h.magic = magic
+
+	for _, field := range []*int{&h.width, &h.height, &h.maxval} {
+		if *field, err = readPNMNumber(r); err != nil {
+			return h, err
+		}
+	}
+	if h.width == 0 || h.height == 0 || h.maxval == 0 || h.maxval > 0xFFFF {
+		return h, errors.New("pnm: invalid header")
+	}
+	if h.width > 1<<16 || h.height > 1<<16 {
+		return h, errors.New("pnm: image too large")
+	}
+	return h, nil
+}
+
+func decodePNMConfig(r io.Reader) (image.Config, error) {
+	h, err := readPNMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	config := image.Config{Width: h.width, Height: h.height}
+	switch {
+	case h.gray() && h.deep():
+		config.ColorModel = color.Gray16Model
+	case h.gray():
+		config.ColorModel = color.GrayModel
+	case h.deep():
+		config.ColorModel = color.RGBA64Model
+	default:
+		config.ColorModel = color.RGBAModel
+	}
+	return config, nil
+}
+
+// decodePNM reads a graymap into Gray or Gray16 and a pixmap into RGBA or RGBA64. Samples
+// with a maximum of 255 or 65535 are kept as they are, others are scaled to the full range.
+func decodePNM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readPNMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// sample reads the next sample scaled to 8 or 16 bits
+	full := 0xFF
+	if h.deep() {
+		full = 0xFFFF
+	}
+	sample := func() (int, error) {
+		var v int
+		switch {
+		case h.magic == "P2" || h.magic == "P3":
+			v, err = readPNMNumber(br)
+		case h.deep():
+			var hi, lo byte
+			if hi, err = br.ReadByte(); err == nil {
+				lo, err = br.ReadByte()
+			}
+			v = int(hi)<<8 | int(lo)
+		default:
+			var b byte
+			b, err = br.ReadByte()
+			v = int(b)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if v > h.maxval {
+			return 0, errors.New("pnm: sample exceeds the maximum value")
+		}
+		if h.maxval != full {
+			v = (v*full + h.maxval/2) / h.maxval
+		}
+		return v, nil
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	channels := 3
+	var img image.Image
+	var pix []byte
+	switch {
+	case h.gray() && h.deep():
+		m := image.NewGray16(rect)
+		img, pix, channels = m, m.Pix, 1
+	case h.gray():
+		m := image.NewGray(rect)
+		img, pix, channels = m, m.Pix, 1
+	case h.deep():
+		m := image.NewRGBA64(rect)
+		img, pix = m, m.Pix
+	default:
+		m := image.NewRGBA(rect)
+		img, pix = m, m.Pix
+	}
+
+	// Pixmaps get an opaque alpha sample after their three color samples
+	size := 1
+	if h.deep() {
+		size = 2
+	}
+	for i := 0; i < len(pix); {
+		for c := 0; c < channels; c++ {
+			v, err := sample()
+			if err != nil {
+				return nil, err
+			}
+			if size == 2 {
+				pix[i], pix[i+1] = byte(v>>8), byte(v)
+			} else {
+				pix[i] = byte(v)
+			}
+			i += size
+		}
+		if channels == 3 {
+			for j := 0; j < size; j++ {
+				pix[i+j] = 0xFF
+			}
+			i += size
+		}
+	}
+	return img, nil
+}
+
+// encodePNM writes grayscale images as binary graymaps and the rest as binary pixmaps,
+// with 16-bit samples for 16-bit images. Transparency is not stored.
+func encodePNM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	bw := bufio.NewWriter(w)
+
+	magic, maxval := "P6", 0xFF
+	switch img.(type) {
+	case *image.Gray:
+		magic = "P5"
+	case *image.Gray16:
+		magic, maxval = "P5", 0xFFFF
+	}
+	if isDeep(img) {
+		maxval = 0xFFFF
+	}
+	if _, err := fmt.Fprintf(bw, "%s\n%d %d\n%d\n", magic, b.Dx(), b.Dy(), maxval); err != nil {
+		return err
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			switch img := img.(type) {
+			case *image.Gray:
+				bw.WriteByte(img.GrayAt(x, y).Y)
+			case *image.Gray16:
+				v := img.Gray16At(x, y).Y
+				bw.Write([]byte{byte(v >> 8), byte(v)})
+			default:
+				if maxval == 0xFF {
+					c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+					bw.Write([]byte{c.R, c.G, c.B})
+				} else {
+					c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+					bw.Write([]byte{byte(c.R >> 8), byte(c.R), byte(c.G >> 8), byte(c.G), byte(c.B >> 8), byte(c.B)})
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,306 @@
+package imageio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// webpMaxSize is the largest width and height a lossless WebP can have
+const webpMaxSize = 1 << 14
+
+// vp8lCodeLengthOrder is the order the lengths of the code length code are stored in
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lWriter writes the least significant bit first, as VP8L expects
+type vp8lWriter struct {
+	buf   bytes.Buffer
+	bits  uint64
+	nBits uint
+}
+
+// write appends the n low bits of v
+func (w *vp8lWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf.WriteByte(byte(w.bits))
+		w.bits >>= 8
+		w.nBits -= 8
+	}
+}
+
+// bytes flushes the last partial byte and returns the stream
+func (w *vp8lWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf.WriteByte(byte(w.bits))
+		w.bits, w.nBits = 0, 0
+	}
+	return w.buf.Bytes()
+}
+
+// prefixCode is a canonical Huffman code. A code with a single symbol takes no bits.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+	used    []int
+}
+
+// writeSymbol writes the code of a symbol, most significant bit first
+func (c *prefixCode) writeSymbol(w *vp8lWriter, symbol int) {
+	if len(c.used) < 2 {
+		return
+	}
+	code, n := c.codes[symbol], uint(c.lengths[symbol])
+	for i := n; i > 0; i-- {
+		w.write(code>>(i-1)&1, 1)
+	}
+}
+
+// newPrefixCode builds a code for the histogram with no code longer than limit bits
+func newPrefixCode(counts []int, limit int) *prefixCode {
+	c := &prefixCode{lengths: make([]uint8, len(counts)), codes: make([]uint32, len(counts))}
+	for symbol, n := range counts {
+		if n > 0 {
+			c.used = append(c.used, symbol)
+		}
+	}
+	switch len(c.used) {
+	case 0:
+		return c
+	case 1:
+		c.lengths[c.used[0]] = 1
+		return c
+	}
+
+	// Rare symbols are made more frequent until the tree is shallow enough
+	weights := make([]int, len(counts))
+	copy(weights, counts)
+	for floor := 1; !huffmanLengths(weights, c.used, c.lengths, limit); floor *= 2 {
+		for _, symbol := range c.used {
+			weights[symbol] = max(weights[symbol], floor)
+		}
+	}
+
+	// Canonical codes are assigned by length, then by symbol
+	var histogram [16]uint32
+	for _, symbol := range c.used {
+		histogram[c.lengths[symbol]]++
+	}
+	var next [16]uint32
+	for n, code := 1, uint32(0); n < len(next); n++ {
+		code = (code + histogram[n-1]) << 1
+		next[n] = code
+	}
+	for _, symbol := range c.used {
+		c.codes[symbol] = next[c.lengths[symbol]]
+		next[c.lengths[symbol]]++
+	}
+	return c
+}
+
+// huffmanLengths fills in the Huffman code lengths of the used symbols and reports whether
+// none of them is longer than limit
+func huffmanLengths(weights []int, used []int, lengths []uint8, limit int) bool {
+	type node struct {
+		weight      int
+		symbol      int
+		left, right int
+	}
+
+	// Leaves sorted by weight are merged with the internal nodes, which are created in
+	// increasing weight order, so the two smallest nodes are always at one of the queue heads
+	nodes := make([]node, 0, 2*len(used))
+	for _, symbol := range used {
+		nodes = append(nodes, node{weight: weights[symbol], symbol: symbol, left: -1, right: -1})
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+	leaf, internal := 0, len(used)
+	smallest := func() int {
+		if leaf < len(used) && (internal == len(nodes) || nodes[leaf].weight <= nodes[internal].weight) {
+			leaf++
+			return leaf - 1
+		}
+		internal++
+		return internal - 1
+	}
+	for len(nodes) < 2*len(used)-1 {
+		a, b := smallest(), smallest()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+	}
+
+	// Children always precede their parent, so depths are filled in from the root down
+	depth := make([]int, len(nodes))
+	fits := true
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		if n.left >= 0 {
+			depth[n.left], depth[n.right] = depth[i]+1, depth[i]+1
+			continue
+		}
+		if depth[i] > limit {
+			fits = false
+		}
+		lengths[n.symbol] = uint8(depth[i])
+	}
+	return fits
+}
+
+// writePrefixCode stores a code: as a simple code when it has at most two symbols that fit
+// in eight bits, otherwise as code lengths that are themselves prefix coded
+func writePrefixCode(w *vp8lWriter, c *prefixCode) {
+	if len(c.used) <= 2 && (len(c.used) == 0 || c.used[len(c.used)-1] < 0x100) {
+		used := c.used
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+		}
+		// The decoder gives the first symbol code 0, as the canonical code does
+		return
+	}
+	w.write(0, 1)
+
+	// Runs of zeros use code 17 (3 to 10) and 18 (11 to 138); other lengths are stored as they are
+	type token struct {
+		symbol int
+		extra  uint32
+		bits   uint
+	}
+	var tokens []token
+	counts := make([]int, len(vp8lCodeLengthOrder))
+	for i := 0; i < len(c.lengths); {
+		run := 0
+		for i+run < len(c.lengths) && c.lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		var t token
+		switch {
+		case run >= 11:
+			t = token{18, uint32(run - 11), 7}
+		case run >= 3:
+			t = token{17, uint32(run - 3), 3}
+		default:
+			t, run = token{int(c.lengths[i]), 0, 0}, 1
+		}
+		tokens = append(tokens, t)
+		counts[t.symbol]++
+		i += run
+	}
+
+	lengthCode := newPrefixCode(counts, 7)
+	n := 4
+	for i, symbol := range vp8lCodeLengthOrder {
+		if lengthCode.lengths[symbol] > 0 {
+			n = max(n, i+1)
+		}
+	}
+	w.write(uint32(n-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:n] {
+		w.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+
+	// Every length is stored, so there is no maximum symbol
+	w.write(0, 1)
+	for _, t := range tokens {
+		lengthCode.writeSymbol(w, t.symbol)
+		w.write(t.extra, t.bits)
+	}
+}
+
+// encodeWebP writes the image as a lossless WebP. Pixels are stored as literals after the
+// subtract green transform, without backward references or a color cache: the files are
+// larger than those of libwebp, but every pixel is kept exactly.
+func encodeWebP(out io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width == 0 || height == 0 || width > webpMaxSize || height > webpMaxSize {
+		return errors.New("webp: image size must be between 1 and 16384 pixels")
+	}
+
+	// pixels holds the green, red, blue and alpha values with red and blue minus green
+	pixels := make([][4]uint8, 0, width*height)
+	var counts [4][]int
+	counts[0] = make([]int, 256+24)
+	for i := 1; i < len(counts); i++ {
+		counts[i] = make([]int, 256)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			p := [4]uint8{c.G, c.R - c.G, c.B - c.G, c.A}
+			pixels = append(pixels, p)
+			for i, v := range p {
+				counts[i][v]++
+			}
+		}
+	}
+
+	w := &vp8lWriter{}
+	w.write(0x2f, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if isOpaque(img) {
+		w.write(0, 1)
+	} else {
+		w.write(1, 1)
+	}
+	w.write(0, 3)
+
+	// The subtract green transform, then the end of the transforms
+	w.write(1, 1)
+	w.write(2, 2)
+	w.write(0, 1)
+
+	// No color cache and a single group of codes for the whole image
+	w.write(0, 1)
+	w.write(0, 1)
+
+	var codes [4]*prefixCode
+	for i := range codes {
+		codes[i] = newPrefixCode(counts[i], 15)
+		writePrefixCode(w, codes[i])
+	}
+	// The distance code is never used
+	writePrefixCode(w, newPrefixCode(make([]int, 40), 15))
+
+	for _, p := range pixels {
+		for i, v := range p {
+			codes[i].writeSymbol(w, int(v))
+		}
+	}
+	data := w.bytes()
+
+	var header [20]byte
+	size := 4 + 8 + len(data) + len(data)%2
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(size))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := out.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		return err
+	}
+	if len(data)%2 == 1 {
+		_, err := out.Write([]byte{0})
+		return err
+	}
+	return nil
+}
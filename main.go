@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"image/png"
+	"io"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -18,35 +23,93 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"github.com/disintegration/imaging"
 
+	"kursovaya/imageio"
 	"kursovaya/stego"
 )
 
+// uiLanguage selects the localized algorithm names and descriptions shown in the interface
+const uiLanguage = "ru"
+
+// Payload encryption modes
+const (
+	EncryptionNone       = "Без шифрования"
+	EncryptionPassword   = "Пароль"
+	EncryptionRecipients = "Открытые ключи получателей"
+)
+
+// Modes of spreading the payload over cover images
 const (
-	AlgorithmFractal = "Фрактал"
+	EmbedModeSingle = "Один контейнер"
+	EmbedModeSplit  = "Разделить на части"
+	EmbedModeShare  = "Пороговое разделение (k из n)"
+	// EmbedModeDeniable hides a decoy and a hidden payload under two keys
+	EmbedModeDeniable = "Двойное (ложные + скрытые данные)"
 )
 
+// profileModes maps the embedding modes of the form to the modes stored in profiles
+var profileModes = map[string]string{
+	EmbedModeSingle:   stego.ModeSingle,
+	EmbedModeSplit:    stego.ModeSplit,
+	EmbedModeShare:    stego.ModeShare,
+	EmbedModeDeniable: stego.ModeDeniable,
+}
+
+// profileEncryptions maps the encryption modes of the form to the modes stored in profiles
+var profileEncryptions = map[string]string{
+	EncryptionNone:       stego.EncryptionNone,
+	EncryptionPassword:   stego.EncryptionPassword,
+	EncryptionRecipients: stego.EncryptionRecipients,
+}
+
+// lastProfileKey is the preference holding the settings of the last successful embedding
+const lastProfileKey = "lastProfile"
+
 type StegoApp struct {
 	app                      fyne.App
 	window                   fyne.Window
 	coverImagePath           *widget.Entry
-	secretDataPath           *widget.Entry
+	embedMode                *widget.Select
+	shareThreshold           *widget.Entry
+	hiddenPaths              []string
+	hiddenList               *widget.List
+	decoyKey                 *widget.Entry
+	hiddenKey                *widget.Entry
+	extraCoverPaths          []string
+	extraCoverList           *widget.List
+	secretPaths              []string
+	secretList               *widget.List
+	encryptionMode           *widget.Select
+	embedPassword            *widget.Entry
+	recipientPaths           []string
+	recipientList            *widget.List
+	signingKeyPath           *widget.Entry
 	stegoImagePath           *widget.Entry
+	extraStegoPaths          []string
+	extraStegoList           *widget.List
 	outputPath               *widget.Entry
+	outputWarning            *widget.Label
+	extractOutputPath        *widget.Entry
 	algorithm                *widget.RadioGroup
+	extractAlgorithm         *widget.RadioGroup
+	archiveEntries           *widget.CheckGroup
+	deniableExtract          *widget.Check
+	extractPassword          *widget.Entry
+	identityPath             *widget.Entry
+	keyringPath              *widget.Entry
 	embeddingRate            *widget.Slider
-	fractalType              *widget.Select
-	fractalIterations        *widget.Entry
-	fractalThreshold         *widget.Entry
+	embedRegion              *widget.Entry
+	extractRegion            *widget.Entry
+	embedParams              *paramForm
+	extractParams            *paramForm
 	coverImagePreview        *canvas.Image
 	stegoImagePreview        *canvas.Image
 	metricsText              *widget.Label
 	originalImagePath        *widget.Entry
 	stegoImagePathForMetrics *widget.Entry
-	fractalParamsGroup       *fyne.Container
 }
 
 func NewStegoApp() *StegoApp {
-	a := app.New()
+	a := app.NewWithID("kursovaya.stego")
 	w := a.NewWindow("Стеганография с фракталами")
 	w.Resize(fyne.NewSize(1200, 700))
 
@@ -56,6 +119,7 @@ func NewStegoApp() *StegoApp {
 	}
 
 	stegApp.createUI()
+	stegApp.restoreProfile()
 	return stegApp
 }
 
@@ -75,53 +139,156 @@ func (a *StegoApp) createEmbedTab() *container.TabItem {
 	coverBrowse := widget.NewButton("Выбрать", a.browseCoverImage)
 	coverBrowse.Resize(fyne.NewSize(120, 38))
 
-	// Secret Data Selection
-	a.secretDataPath = widget.NewEntry()
-	secretBrowse := widget.NewButton("Выбрать", a.browseSecretData)
-	secretBrowse.Resize(fyne.NewSize(120, 38))
+	// Additional covers for splitting or sharing the payload
+	a.extraCoverList = newPathList(&a.extraCoverPaths)
+	extraCoverBrowse := widget.NewButton("Добавить контейнер", func() {
+		a.browseAppendPath(&a.extraCoverPaths, a.extraCoverList)
+	})
+	extraCoverClear := widget.NewButton("Очистить", func() {
+		a.extraCoverPaths = nil
+		a.extraCoverList.Refresh()
+	})
+	a.shareThreshold = widget.NewEntry()
+	a.shareThreshold.SetText("2")
+	shareGroup := container.NewVBox(
+		widget.NewLabel("Сколько изображений нужно для восстановления (k):"),
+		a.shareThreshold,
+	)
+	splitGroup := container.NewVBox(
+		widget.NewLabel("Дополнительные контейнеры (части нумеруются по имени выходного файла):"),
+		container.NewGridWrap(fyne.NewSize(800, 90), a.extraCoverList),
+		container.NewHBox(extraCoverBrowse, extraCoverClear),
+		shareGroup,
+	)
+	splitGroup.Hide()
 
-	// Algorithm Selection
-	a.algorithm = widget.NewRadioGroup([]string{AlgorithmFractal}, nil)
-	a.algorithm.SetSelected(AlgorithmFractal)
-	a.algorithm.OnChanged = a.toggleFractalParams
-
-	// Fractal Parameters
-	a.fractalType = widget.NewSelect([]string{"Мандельброт", "Жулиа"}, nil)
-	a.fractalType.SetSelected("Мандельброт")
-	a.fractalIterations = widget.NewEntry()
-	a.fractalIterations.SetText("100")
-	a.fractalThreshold = widget.NewEntry()
-	a.fractalThreshold.SetText("2.0")
-
-	a.fractalParamsGroup = container.NewVBox(
-		widget.NewLabel("Параметры фрактала:"),
-		container.NewVBox(
-			widget.NewLabel("Тип фрактала:"),
-			a.fractalType,
-			widget.NewLabel("Итерация:"),
-			a.fractalIterations,
-			widget.NewLabel("Порог:"),
-			a.fractalThreshold,
-		),
+	// Hidden payload for deniable embedding, the main secret files become the decoy
+	a.hiddenList = newPathList(&a.hiddenPaths)
+	hiddenBrowse := widget.NewButton("Добавить файл", func() {
+		a.browseAppendPath(&a.hiddenPaths, a.hiddenList)
+	})
+	hiddenClear := widget.NewButton("Очистить", func() {
+		a.hiddenPaths = nil
+		a.hiddenList.Refresh()
+	})
+	a.decoyKey = widget.NewPasswordEntry()
+	a.hiddenKey = widget.NewPasswordEntry()
+	deniableGroup := container.NewVBox(
+		widget.NewLabel("Ключ ложных данных (файлы для встраивания ниже):"),
+		a.decoyKey,
+		widget.NewLabel("Скрытые файлы (необязательно):"),
+		container.NewGridWrap(fyne.NewSize(800, 90), a.hiddenList),
+		container.NewHBox(hiddenBrowse, hiddenClear),
+		widget.NewLabel("Ключ скрытых данных:"),
+		a.hiddenKey,
 	)
-	a.fractalParamsGroup.Hide()
+	deniableGroup.Hide()
+
+	modes := []string{EmbedModeSingle, EmbedModeSplit, EmbedModeShare, EmbedModeDeniable}
+	a.embedMode = widget.NewSelect(modes, func(mode string) {
+		splitGroup.Hide()
+		shareGroup.Hide()
+		deniableGroup.Hide()
+		switch mode {
+		case EmbedModeSplit:
+			splitGroup.Show()
+		case EmbedModeShare:
+			shareGroup.Show()
+			splitGroup.Show()
+		case EmbedModeDeniable:
+			deniableGroup.Show()
+		}
+	})
+	a.embedMode.SetSelected(EmbedModeSingle)
+
+	// Secret Data Selection
+	a.secretList = newPathList(&a.secretPaths)
+	secretBrowse := widget.NewButton("Добавить файл", func() {
+		a.browseAppendPath(&a.secretPaths, a.secretList)
+	})
+	secretFolderBrowse := widget.NewButton("Добавить папку", a.browseSecretFolder)
+	secretClear := widget.NewButton("Очистить", func() {
+		a.secretPaths = nil
+		a.secretList.Refresh()
+	})
+
+	// Algorithm Selection with the parameter form of the selected algorithm
+	algorithmDescription := widget.NewLabel("")
+	algorithmDescription.Wrapping = fyne.TextWrapWord
+	a.embedParams = newParamForm()
+	a.algorithm = widget.NewRadioGroup(algorithmNames(), func(name string) {
+		algorithmDescription.SetText(algorithmDescriptionText(name))
+		a.embedParams.SetAlgorithm(name)
+	})
+	a.algorithm.SetSelected(a.algorithm.Options[0])
 
 	// Embedding Rate
 	a.embeddingRate = widget.NewSlider(0.1, 0.9)
 	a.embeddingRate.Value = 0.4
 	rateLabel := widget.NewLabel(fmt.Sprintf("Коэффициент встраивания: %.1f", a.embeddingRate.Value))
+	a.embedRegion = newRegionEntry()
 	a.embeddingRate.OnChanged = func(v float64) {
 		rateLabel.SetText(fmt.Sprintf("Коэффициент встраивания: %.1f", v))
 	}
 
+	// Encryption
+	a.embedPassword = widget.NewPasswordEntry()
+	passwordGroup := container.NewVBox(widget.NewLabel("Пароль:"), a.embedPassword)
+	a.recipientList = newPathList(&a.recipientPaths)
+	recipientBrowse := widget.NewButton("Добавить ключ", func() {
+		a.browseAppendPath(&a.recipientPaths, a.recipientList)
+	})
+	recipientClear := widget.NewButton("Очистить", func() {
+		a.recipientPaths = nil
+		a.recipientList.Refresh()
+	})
+	recipientGroup := container.NewVBox(
+		widget.NewLabel("Открытые ключи X25519 получателей:"),
+		container.NewGridWrap(fyne.NewSize(800, 90), a.recipientList),
+		container.NewHBox(recipientBrowse, recipientClear),
+	)
+	a.encryptionMode = widget.NewSelect([]string{EncryptionNone, EncryptionPassword, EncryptionRecipients}, func(mode string) {
+		passwordGroup.Hide()
+		recipientGroup.Hide()
+		switch mode {
+		case EncryptionPassword:
+			passwordGroup.Show()
+		case EncryptionRecipients:
+			recipientGroup.Show()
+		}
+	})
+	a.encryptionMode.SetSelected(EncryptionNone)
+
+	// Signing
+	a.signingKeyPath = widget.NewEntry()
+	signingKeyBrowse := widget.NewButton("Выбрать", func() {
+		a.browseFile(a.signingKeyPath)
+	})
+
 	// Output Path
 	a.outputPath = widget.NewEntry()
 	outputBrowse := widget.NewButton("Выбрать", a.browseOutput)
 	outputBrowse.Resize(fyne.NewSize(120, 38))
+	a.outputWarning = widget.NewLabel("")
+	a.outputWarning.Wrapping = fyne.TextWrapWord
+	a.outputWarning.Importance = widget.WarningImportance
+	a.outputWarning.Hide()
+	a.outputPath.OnChanged = func(path string) {
+		if warning := outputWarningText(path); warning != "" {
+			a.outputWarning.SetText(warning)
+			a.outputWarning.Show()
+		} else {
+			a.outputWarning.Hide()
+		}
+	}
 
 	// Embed Button
 	embedButton := widget.NewButton("Встроить данные", a.embedData)
 
+	// Profiles
+	profileLoad := widget.NewButton("Загрузить профиль", a.loadProfile)
+	profileSave := widget.NewButton("Сохранить профиль", a.saveProfile)
+
 	// Image Previews
 	a.coverImagePreview = canvas.NewImageFromResource(nil)
 	a.coverImagePreview.SetMinSize(fyne.NewSize(200, 200))
@@ -135,17 +302,33 @@ func (a *StegoApp) createEmbedTab() *container.TabItem {
 
 	// Form Layout
 	form := container.NewVBox(
+		container.NewHBox(widget.NewLabel("Профиль настроек (JSON или TOML):"), profileLoad, profileSave),
 		widget.NewLabel("Стеганографический контейнер:"),
 		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.coverImagePath, coverBrowse),
-		widget.NewLabel("Файл для встраивания:"),
-		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.secretDataPath, secretBrowse),
+		widget.NewLabel("Режим встраивания:"),
+		a.embedMode,
+		splitGroup,
+		deniableGroup,
+		widget.NewLabel("Файлы для встраивания:"),
+		container.NewGridWrap(fyne.NewSize(800, 90), a.secretList),
+		container.NewHBox(secretBrowse, secretFolderBrowse, secretClear),
 		widget.NewLabel("Алгоритм встраивания:"),
 		a.algorithm,
-		a.fractalParamsGroup,
+		algorithmDescription,
+		a.embedParams.box,
 		rateLabel,
 		a.embeddingRate,
+		widget.NewLabel("Область встраивания x0,y0,x1,y1 (пусто — всё изображение):"),
+		a.embedRegion,
+		widget.NewLabel("Шифрование:"),
+		a.encryptionMode,
+		passwordGroup,
+		recipientGroup,
+		widget.NewLabel("Закрытый ключ Ed25519 для подписи (необязательно):"),
+		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.signingKeyPath, signingKeyBrowse),
 		widget.NewLabel("Выходной файл:"),
 		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.outputPath, outputBrowse),
+		a.outputWarning,
 		embedButton,
 		previews,
 	)
@@ -159,14 +342,53 @@ func (a *StegoApp) createExtractTab() *container.TabItem {
 	stegoBrowse := widget.NewButton("Выбрать", a.browseStegoImage)
 	stegoBrowse.Resize(fyne.NewSize(120, 38))
 
+	// Other pieces of a split payload
+	a.extraStegoList = newPathList(&a.extraStegoPaths)
+	extraStegoBrowse := widget.NewButton("Добавить часть", func() {
+		a.browseAppendPath(&a.extraStegoPaths, a.extraStegoList)
+	})
+	extraStegoClear := widget.NewButton("Очистить", func() {
+		a.extraStegoPaths = nil
+		a.extraStegoList.Refresh()
+	})
+
 	// Output Path
-	outputPath := widget.NewEntry()
-	outputBrowse := widget.NewButton("Выбрать", a.browseOutput)
-	outputBrowse.Resize(fyne.NewSize(120, 38))
+	a.extractOutputPath = widget.NewEntry()
+	outputBrowse := widget.NewButton("Файл", func() {
+		a.browseSaveFile(a.extractOutputPath)
+	})
+	outputFolderBrowse := widget.NewButton("Папка", func() {
+		a.browseFolder(a.extractOutputPath)
+	})
 
 	// Algorithm Selection
-	algorithm := widget.NewRadioGroup([]string{AlgorithmFractal}, nil)
-	algorithm.SetSelected(AlgorithmFractal)
+	a.extractParams = newParamForm()
+	a.extractAlgorithm = widget.NewRadioGroup(algorithmNames(), a.extractParams.SetAlgorithm)
+	a.extractAlgorithm.SetSelected(a.extractAlgorithm.Options[0])
+	detectButton := widget.NewButton("Определить алгоритм и параметры", a.detectParams)
+	a.extractRegion = newRegionEntry()
+
+	// Decryption
+	a.extractPassword = widget.NewPasswordEntry()
+	a.identityPath = widget.NewEntry()
+	identityBrowse := widget.NewButton("Выбрать", func() {
+		a.browseFile(a.identityPath)
+	})
+
+	// Signature verification
+	a.keyringPath = widget.NewEntry()
+	keyringBrowse := widget.NewButton("Файл", func() {
+		a.browseFile(a.keyringPath)
+	})
+	keyringFolderBrowse := widget.NewButton("Папка", func() {
+		a.browseFolder(a.keyringPath)
+	})
+
+	a.deniableExtract = widget.NewCheck("Двойное встраивание (пароль служит ключом)", nil)
+
+	// Archive Contents
+	a.archiveEntries = widget.NewCheckGroup(nil, nil)
+	listButton := widget.NewButton("Показать содержимое", a.listArchive)
 
 	// Extract Button
 	extractButton := widget.NewButton("Извлечь данные", a.extractData)
@@ -175,10 +397,29 @@ func (a *StegoApp) createExtractTab() *container.TabItem {
 	form := container.NewVBox(
 		widget.NewLabel("Входное изображение:"),
 		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.stegoImagePath, stegoBrowse),
-		widget.NewLabel("Выходной файл с данными:"),
-		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, outputPath, outputBrowse),
+		widget.NewLabel("Остальные части или доли разделённых данных (в любом порядке):"),
+		container.NewGridWrap(fyne.NewSize(800, 90), a.extraStegoList),
+		container.NewHBox(extraStegoBrowse, extraStegoClear),
+		widget.NewLabel("Выходной файл с данными (папка для архива):"),
+		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.extractOutputPath,
+			container.NewGridWithColumns(2, outputBrowse, outputFolderBrowse)),
 		widget.NewLabel("Алгоритм извлечения:"),
-		algorithm,
+		a.extractAlgorithm,
+		a.extractParams.box,
+		widget.NewLabel("Область встраивания x0,y0,x1,y1 (пусто — всё изображение):"),
+		a.extractRegion,
+		detectButton,
+		widget.NewLabel("Пароль (для данных, зашифрованных паролем):"),
+		a.extractPassword,
+		a.deniableExtract,
+		widget.NewLabel("Закрытый ключ X25519 (вместо пароля):"),
+		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.identityPath, identityBrowse),
+		widget.NewLabel("Доверенные открытые ключи Ed25519 для проверки подписи:"),
+		container.New(&weightedLayout{leftWeight: 0.8, rightWeight: 0.2}, a.keyringPath,
+			container.NewGridWithColumns(2, keyringBrowse, keyringFolderBrowse)),
+		listButton,
+		widget.NewLabel("Содержимое архива (пустой выбор — извлечь всё):"),
+		container.NewVScroll(a.archiveEntries),
 		extractButton,
 	)
 
@@ -189,13 +430,13 @@ func (a *StegoApp) createMetricsTab() *container.TabItem {
 	// Original and Stego Image Selection
 	a.originalImagePath = widget.NewEntry()
 	originalBrowse := widget.NewButton("Выбрать", func() {
-		a.browseImage(a.originalImagePath)
+		a.browseFile(a.originalImagePath)
 	})
 	originalBrowse.Resize(fyne.NewSize(120, 38))
 
 	a.stegoImagePathForMetrics = widget.NewEntry()
 	stegoBrowse := widget.NewButton("Выбрать", func() {
-		a.browseImage(a.stegoImagePathForMetrics)
+		a.browseFile(a.stegoImagePathForMetrics)
 	})
 	stegoBrowse.Resize(fyne.NewSize(120, 38))
 
@@ -223,12 +464,44 @@ func (a *StegoApp) createMetricsTab() *container.TabItem {
 	return container.NewTabItem("Анализ метрик", form)
 }
 
-func (a *StegoApp) toggleFractalParams(s string) {
-	if s == AlgorithmFractal {
-		a.fractalParamsGroup.Show()
-	} else {
-		a.fractalParamsGroup.Hide()
+// algorithmNames returns the display names of all registered algorithms
+func algorithmNames() []string {
+	var names []string
+	for _, info := range stego.Registered() {
+		names = append(names, info.DisplayName(uiLanguage))
+	}
+	return names
+}
+
+// algorithmDisplayName returns the localized name of an algorithm, or its ID when it is not registered
+func algorithmDisplayName(algorithm stego.Steganographer) string {
+	if info, ok := stego.Lookup(algorithm.Name()); ok {
+		return info.DisplayName(uiLanguage)
 	}
+	return algorithm.Name()
+}
+
+// outputWarningText explains what saving the stego image to path does to the payload,
+// or returns an empty string when the format keeps it
+func outputWarningText(path string) string {
+	if path == "" {
+		return ""
+	}
+	if err := imageio.CheckOutput(path, ""); err != nil {
+		return "Формат с потерями уничтожит скрытые данные, встраивание будет отклонено: " + err.Error()
+	}
+	if ext := filepath.Ext(path); ext == "" {
+		return "Расширение не указано: изображение будет сохранено в формате PNG"
+	} else if _, ok := imageio.LookupFormat(ext); !ok {
+		return "Неизвестное расширение " + ext + ": изображение будет сохранено в формате PNG"
+	}
+	return ""
+}
+
+// algorithmDescriptionText returns the description of the algorithm with the given display name
+func algorithmDescriptionText(name string) string {
+	info, _ := stego.Lookup(name)
+	return info.Description(uiLanguage)
 }
 
 func (a *StegoApp) browseCoverImage() {
@@ -240,10 +513,42 @@ func (a *StegoApp) browseCoverImage() {
 	}, a.window)
 }
 
-func (a *StegoApp) browseSecretData() {
+// newRegionEntry creates an entry for a region of interest that validates it as it is typed
+func newRegionEntry() *widget.Entry {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("0,0,640,480")
+	entry.Validator = func(text string) error {
+		_, err := stego.ParseRegion(text)
+		return err
+	}
+	return entry
+}
+
+// newPathList creates a list widget showing the paths stored in *paths
+func newPathList(paths *[]string) *widget.List {
+	return widget.NewList(
+		func() int { return len(*paths) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText((*paths)[id])
+		},
+	)
+}
+
+func (a *StegoApp) browseAppendPath(paths *[]string, list *widget.List) {
 	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
 		if err == nil && reader != nil {
-			a.secretDataPath.SetText(reader.URI().Path())
+			*paths = append(*paths, reader.URI().Path())
+			list.Refresh()
+		}
+	}, a.window)
+}
+
+func (a *StegoApp) browseSecretFolder() {
+	dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+		if err == nil && uri != nil {
+			a.secretPaths = append(a.secretPaths, uri.Path())
+			a.secretList.Refresh()
 		}
 	}, a.window)
 }
@@ -264,7 +569,23 @@ func (a *StegoApp) browseOutput() {
 	}, a.window)
 }
 
-func (a *StegoApp) browseImage(entry *widget.Entry) {
+func (a *StegoApp) browseSaveFile(entry *widget.Entry) {
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err == nil && writer != nil {
+			entry.SetText(writer.URI().Path())
+		}
+	}, a.window)
+}
+
+func (a *StegoApp) browseFolder(entry *widget.Entry) {
+	dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+		if err == nil && uri != nil {
+			entry.SetText(uri.Path())
+		}
+	}, a.window)
+}
+
+func (a *StegoApp) browseFile(entry *widget.Entry) {
 	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
 		if err == nil && reader != nil {
 			entry.SetText(reader.URI().Path())
@@ -300,227 +621,930 @@ func (a *StegoApp) embedData() {
 		dialog.ShowError(errors.New("please select a cover image"), a.window)
 		return
 	}
-	if a.secretDataPath.Text == "" {
-		dialog.ShowError(errors.New("please select a secret data file"), a.window)
+	if len(a.secretPaths) == 0 {
+		dialog.ShowError(errors.New("please select secret data files"), a.window)
 		return
 	}
 	if a.outputPath.Text == "" {
 		dialog.ShowError(errors.New("please specify an output path"), a.window)
 		return
 	}
+	// Lossy formats would destroy the payload, and GIF the true color output of most
+	// algorithms, so they are refused before embedding
+	algorithmInfo, _ := stego.Lookup(a.algorithm.Selected)
+	if err := imageio.CheckAnimationOutput(a.outputPath.Text, "", nil, algorithmInfo.KeepsPalette); err != nil {
+		dialog.ShowError(err, a.window)
+		return
+	}
 
-	// Load the cover image
-	coverImage, err := loadImage(a.coverImagePath.Text)
-	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to load cover image: %w", err), a.window)
+	// Deniable embedding encrypts both payloads with their own keys
+	if a.embedMode.Selected == EmbedModeDeniable {
+		a.embedDeniable()
 		return
 	}
 
-	// Load the secret data
-	secretData, err := os.ReadFile(a.secretDataPath.Text)
+	// Collect the encryption settings
+	encryptOptions, err := a.encryptOptions()
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to load secret data: %w", err), a.window)
+		dialog.ShowError(err, a.window)
 		return
 	}
 
+	// Load the signing key if one is given
+	var signingKey ed25519.PrivateKey
+	if a.signingKeyPath.Text != "" {
+		signingKey, err = stego.LoadSigningKey(a.signingKeyPath.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to load signing key: %w", err), a.window)
+			return
+		}
+	}
+
 	// Create steganography config
-	config := stego.Config{
-		EmbeddingRate: a.embeddingRate.Value,
+	config, err := a.buildConfig(a.algorithm.Selected, a.embedParams, a.embedRegion)
+	if err != nil {
+		dialog.ShowError(err, a.window)
+		return
 	}
 
-	// Set fractal parameters if needed
-	if a.algorithm.Selected == AlgorithmFractal {
-		// Parse fractal parameters
-		iterations, err := strconv.Atoi(a.fractalIterations.Text)
+	// Get the appropriate steganography algorithm
+	algorithm, err := stego.Factory(a.algorithm.Selected)
+	if err != nil {
+		dialog.ShowError(err, a.window)
+		return
+	}
+
+	secretPaths := append([]string(nil), a.secretPaths...)
+	coverPath, outputPath := a.coverImagePath.Text, a.outputPath.Text
+
+	if a.embedMode.Selected == EmbedModeSplit || a.embedMode.Selected == EmbedModeShare {
+		a.embedMultiCover(algorithm, config, func() ([]byte, error) {
+			return sealSecret(secretPaths, encryptOptions, signingKey)
+		})
+		return
+	}
+
+	plain := encryptOptions.Password == "" && len(encryptOptions.Recipients) == 0 && signingKey == nil
+
+	a.runTask("Встраивание данных", func(ctx context.Context, progress stego.Progress) error {
+		// Load the cover image with all frames of an animation
+		cover, err := imageio.LoadAnimation(coverPath)
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("invalid iterations value: %w", err), a.window)
-			return
+			return fmt.Errorf("failed to load cover image: %w", err)
+		}
+		if err := imageio.CheckAnimationOutput(outputPath, "", cover, algorithmInfo.KeepsPalette); err != nil {
+			return err
+		}
+
+		// A plain single file goes into a still image without being read into memory whole
+		if len(cover.Frames) == 1 && plain && len(secretPaths) == 1 {
+			if info, err := os.Stat(secretPaths[0]); err == nil && info.Mode().IsRegular() {
+				return embedFileStream(ctx, algorithm, config, cover.Frames[0].Image, secretPaths[0], coverPath, outputPath, progress)
+			}
 		}
 
-		threshold, err := strconv.ParseFloat(a.fractalThreshold.Text, 64)
+		secretData, err := sealSecret(secretPaths, encryptOptions, signingKey)
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("invalid threshold value: %w", err), a.window)
-			return
+			return err
+		}
+
+		// Animations carry the payload in pieces spread over their frames
+		if len(cover.Frames) > 1 {
+			frames, err := stego.EmbedFrames(ctx, algorithm, cover.Images(), secretData, config, progress)
+			if err != nil {
+				return fmt.Errorf("failed to embed data: %w", err)
+			}
+			if err := imageio.SaveAnimation(outputPath, cover.WithImages(frames)); err != nil {
+				return fmt.Errorf("failed to save stego image: %w", err)
+			}
+			return stego.Verify(secretData, func() ([]byte, error) {
+				saved, err := imageio.LoadAnimation(outputPath)
+				if err != nil {
+					return nil, err
+				}
+				return stego.ExtractFrames(ctx, algorithm, saved.Images(), config, nil)
+			})
 		}
+		coverImage := cover.Frames[0].Image
 
-		config.FractalParams = &stego.FractalParams{
-			Type:       a.fractalType.Selected,
-			Iterations: iterations,
-			Threshold:  threshold,
+		sealed, err := stego.SealPayload(secretData)
+		if err != nil {
+			return err
+		}
+
+		// Embed the data
+		stegoImage, err := stego.EmbedContext(ctx, algorithm, coverImage, sealed, config, progress)
+		if err != nil {
+			return fmt.Errorf("failed to embed data: %w", err)
 		}
+
+		// Save the stego image with the metadata chunks of the cover, then read it back to
+		// make sure the payload survived
+		if err := imageio.SaveWith(outputPath, stegoImage, imageio.SaveOptions{Cover: coverPath}); err != nil {
+			return fmt.Errorf("failed to save stego image: %w", err)
+		}
+		return stego.Verify(sealed, func() ([]byte, error) {
+			saved, err := imageio.Load(outputPath)
+			if err != nil {
+				return nil, err
+			}
+			return stego.ExtractContext(ctx, algorithm, saved, config, nil)
+		})
+	}, func() {
+		// Update the preview
+		a.loadImagePreview(outputPath, a.stegoImagePreview)
+
+		a.rememberProfile()
+		dialog.ShowInformation("Успех", "Данные успешно сокрыты", a.window)
+	})
+}
+
+// embedFileStream embeds the regular file at path into the cover image, reading it in
+// chunks, and saves and verifies the stego image like the in-memory path does
+func embedFileStream(ctx context.Context, algorithm stego.Steganographer, config stego.Config, coverImage image.Image,
+	path, coverPath, outputPath string, progress stego.Progress) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to load secret data: %w", err)
 	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
 
-	// Get the appropriate steganography algorithm
-	algorithm, err := stego.Factory(a.algorithm.Selected)
+	sealed, err := stego.SealStream(file)
 	if err != nil {
-		dialog.ShowError(err, a.window)
-		return
+		return fmt.Errorf("failed to load secret data: %w", err)
 	}
+	digest := sha256.New()
 
-	// Embed the data
-	stegoImage, err := algorithm.Embed(coverImage, secretData, config)
+	stegoImage, err := stego.EmbedStreamContext(ctx, algorithm, coverImage, io.TeeReader(sealed, digest), config, progress)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to embed data: %w", err), a.window)
-		return
+		return fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	if err := imageio.SaveWith(outputPath, stegoImage, imageio.SaveOptions{Cover: coverPath}); err != nil {
+		return fmt.Errorf("failed to save stego image: %w", err)
 	}
+	return stego.VerifyStream(digest.Sum(nil), func(w io.Writer) error {
+		saved, err := imageio.Load(outputPath)
+		if err != nil {
+			return err
+		}
+		return stego.ExtractStreamContext(ctx, algorithm, saved, w, config, nil)
+	})
+}
 
-	// Save the stego image
-	err = saveImage(a.outputPath.Text, stegoImage)
+// sealSecret loads the secret files, packing several into an archive, then encrypts
+// and signs the data as requested
+func sealSecret(paths []string, encryptOptions stego.EncryptOptions, signingKey ed25519.PrivateKey) ([]byte, error) {
+	secretData, err := stego.PackPaths(paths)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to save stego image: %w", err), a.window)
-		return
+		return nil, fmt.Errorf("failed to load secret data: %w", err)
 	}
 
-	// Update the preview
-	a.loadImagePreview(a.outputPath.Text, a.stegoImagePreview)
+	secretData, err = stego.Encrypt(secretData, encryptOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data: %w", err)
+	}
 
-	dialog.ShowInformation("Успех", "Данные успешно сокрыты", a.window)
+	if signingKey != nil {
+		secretData = stego.Sign(secretData, signingKey)
+	}
+	return secretData, nil
 }
 
-func (a *StegoApp) extractData() {
-	// Check if all required fields are filled
-	if a.stegoImagePath.Text == "" {
-		dialog.ShowError(errors.New("please select a stego image"), a.window)
+// embedDeniable hides the secret files as a decoy and the hidden files under a second key
+func (a *StegoApp) embedDeniable() {
+	if a.decoyKey.Text == "" {
+		dialog.ShowError(errors.New("please enter the decoy key"), a.window)
 		return
 	}
-	if a.outputPath.Text == "" {
-		dialog.ShowError(errors.New("please specify an output path"), a.window)
+	if len(a.hiddenPaths) > 0 && a.hiddenKey.Text == "" {
+		dialog.ShowError(errors.New("please enter the hidden key"), a.window)
 		return
 	}
 
-	// Load the stego image
-	stegoImage, err := loadImage(a.stegoImagePath.Text)
+	config, err := a.buildConfig(a.algorithm.Selected, a.embedParams, a.embedRegion)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to load stego image: %w", err), a.window)
+		dialog.ShowError(err, a.window)
 		return
 	}
 
-	// Create steganography config
-	algorithm := a.algorithm.Selected
-	config := stego.Config{
-		EmbeddingRate: a.embeddingRate.Value,
+	algorithm, err := stego.Factory(a.algorithm.Selected)
+	if err != nil {
+		dialog.ShowError(err, a.window)
+		return
+	}
+	deniable, ok := algorithm.(stego.DeniableSteganographer)
+	if !ok {
+		dialog.ShowError(fmt.Errorf("algorithm %s does not support deniable embedding", algorithmDisplayName(algorithm)), a.window)
+		return
 	}
 
-	// Set fractal parameters if needed
-	if algorithm == AlgorithmFractal {
-		// Parse fractal parameters
-		iterations, err := strconv.Atoi(a.fractalIterations.Text)
+	secretPaths := append([]string(nil), a.secretPaths...)
+	hiddenPaths := append([]string(nil), a.hiddenPaths...)
+	decoyKey, hiddenKey := a.decoyKey.Text, a.hiddenKey.Text
+	coverPath, outputPath := a.coverImagePath.Text, a.outputPath.Text
+
+	a.runTask("Встраивание данных", func(ctx context.Context, progress stego.Progress) error {
+		decoy, err := stego.PackPaths(secretPaths)
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("invalid iterations value: %w", err), a.window)
-			return
+			return fmt.Errorf("failed to load secret data: %w", err)
 		}
 
-		threshold, err := strconv.ParseFloat(a.fractalThreshold.Text, 64)
+		var hidden []byte
+		if len(hiddenPaths) > 0 {
+			hidden, err = stego.PackPaths(hiddenPaths)
+			if err != nil {
+				return fmt.Errorf("failed to load hidden data: %w", err)
+			}
+		}
+
+		coverImage, err := imageio.Load(coverPath)
+		if err != nil {
+			return fmt.Errorf("failed to load cover image: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		stegoImage, err := deniable.EmbedDeniable(coverImage, decoy, decoyKey, hidden, hiddenKey, config)
+		if err != nil {
+			return fmt.Errorf("failed to embed data: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := imageio.SaveWith(outputPath, stegoImage, imageio.SaveOptions{Cover: coverPath}); err != nil {
+			return fmt.Errorf("failed to save stego image: %w", err)
+		}
+
+		// Both payloads are read back, each with its own key
+		saved, err := imageio.Load(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to verify stego image: %w", err)
+		}
+		err = stego.Verify(decoy, func() ([]byte, error) {
+			return deniable.ExtractDeniable(saved, decoyKey, config)
+		})
+		if err == nil && hidden != nil {
+			err = stego.Verify(hidden, func() ([]byte, error) {
+				return deniable.ExtractDeniable(saved, hiddenKey, config)
+			})
+		}
+		return err
+	}, func() {
+		a.loadImagePreview(outputPath, a.stegoImagePreview)
+
+		a.rememberProfile()
+		dialog.ShowInformation("Успех", "Данные успешно сокрыты", a.window)
+	})
+}
+
+// embedMultiCover distributes the secret data returned by secret across the main and
+// additional covers, either as split pieces or as threshold shares
+func (a *StegoApp) embedMultiCover(algorithm stego.Steganographer, config stego.Config, secret func() ([]byte, error)) {
+	share := a.embedMode.Selected == EmbedModeShare
+	var threshold int
+	if share {
+		var err error
+		threshold, err = strconv.Atoi(a.shareThreshold.Text)
 		if err != nil {
 			dialog.ShowError(fmt.Errorf("invalid threshold value: %w", err), a.window)
 			return
 		}
+	}
+
+	coverPaths := append([]string{a.coverImagePath.Text}, a.extraCoverPaths...)
+	outputPath := a.outputPath.Text
+	var saved []string
+
+	a.runTask("Встраивание данных", func(ctx context.Context, progress stego.Progress) error {
+		secretData, err := secret()
+		if err != nil {
+			return err
+		}
+
+		covers := make([]image.Image, len(coverPaths))
+		for i, path := range coverPaths {
+			cover, err := imageio.Load(path)
+			if err != nil {
+				return fmt.Errorf("failed to load cover image %s: %w", path, err)
+			}
+			covers[i] = cover
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var stegoImages []image.Image
+		if share {
+			stegoImages, err = stego.Share(algorithm, covers, secretData, threshold, config)
+			if err != nil {
+				return fmt.Errorf("failed to share data: %w", err)
+			}
+		} else {
+			stegoImages, err = stego.Split(algorithm, covers, secretData, config)
+			if err != nil {
+				return fmt.Errorf("failed to split data: %w", err)
+			}
+		}
+
+		for i, img := range stegoImages {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			path := stego.PartPath(outputPath, i+1)
+			if err := imageio.SaveWith(path, img, imageio.SaveOptions{Cover: coverPaths[i]}); err != nil {
+				return fmt.Errorf("failed to save stego image: %w", err)
+			}
+			saved = append(saved, path)
+			progress.Report(float64(i+1) / float64(len(stegoImages)))
+		}
+
+		return stego.Verify(secretData, func() ([]byte, error) {
+			images := make([]image.Image, len(saved))
+			for i, path := range saved {
+				if images[i], err = imageio.Load(path); err != nil {
+					return nil, err
+				}
+			}
+			return stego.Join(algorithm, images, config)
+		})
+	}, func() {
+		a.loadImagePreview(saved[0], a.stegoImagePreview)
+
+		a.rememberProfile()
+		dialog.ShowInformation("Успех", "Данные разделены на части:\n"+strings.Join(saved, "\n"), a.window)
+	})
+}
+
+// runTask runs work in a goroutine behind a dialog with a progress bar and a cancel button,
+// so the window stays responsive. On success done is called on the UI thread; errors are
+// shown, and cancellation is reported as such.
+func (a *StegoApp) runTask(title string, work func(ctx context.Context, progress stego.Progress) error, done func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bar := widget.NewProgressBar()
+	cancelButton := widget.NewButton("Отмена", nil)
+	progressDialog := dialog.NewCustomWithoutButtons(title, container.NewVBox(bar, cancelButton), a.window)
+	progressDialog.Resize(fyne.NewSize(400, 0))
+	cancelButton.OnTapped = func() {
+		cancel()
+		cancelButton.Disable()
+	}
+	progressDialog.Show()
+
+	// Reports never overlap, so the last shown value needs no lock
+	shown := 0.0
+	progress := stego.ProgressFunc(func(done float64) {
+		if done-shown < 0.01 && done < 1 {
+			return
+		}
+		shown = done
+		fyne.Do(func() {
+			bar.SetValue(done)
+		})
+	})
 
-		config.FractalParams = &stego.FractalParams{
-			Type:       a.fractalType.Selected,
-			Iterations: iterations,
-			Threshold:  threshold,
+	go func() {
+		err := work(ctx, progress)
+		// Work that does not watch the context still finishes; its result is discarded
+		if err == nil {
+			err = ctx.Err()
 		}
+		cancel()
+
+		fyne.Do(func() {
+			progressDialog.Hide()
+			switch {
+			case errors.Is(err, context.Canceled):
+				dialog.ShowInformation(title, "Операция отменена", a.window)
+			case err != nil:
+				dialog.ShowError(err, a.window)
+			default:
+				done()
+			}
+		})
+	}()
+}
+
+// buildConfig collects the steganography config for the given algorithm from its parameter form
+// and region entry
+func (a *StegoApp) buildConfig(algorithm string, form *paramForm, region *widget.Entry) (stego.Config, error) {
+	config := stego.Config{
+		EmbeddingRate: a.embeddingRate.Value,
 	}
 
-	// Get the appropriate steganography algorithm
-	stegoAlgorithm, err := stego.Factory(algorithm)
+	if _, ok := stego.Lookup(algorithm); !ok {
+		return config, fmt.Errorf("unknown steganography algorithm: %s", algorithm)
+	}
+
+	params, err := form.Params()
 	if err != nil {
-		dialog.ShowError(err, a.window)
-		return
+		return config, err
 	}
+	config.Params = params
 
-	// Extract the data
-	data, err := stegoAlgorithm.Extract(stegoImage, config)
+	config.Region, err = stego.ParseRegion(region.Text)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to extract data: %w", err), a.window)
-		return
+		return config, err
+	}
+
+	return config, nil
+}
+
+// currentProfile collects the settings of the embed tab, and the keyring of the extract tab, into a profile
+func (a *StegoApp) currentProfile() (*stego.Profile, error) {
+	config, err := a.buildConfig(a.algorithm.Selected, a.embedParams, a.embedRegion)
+	if err != nil {
+		return nil, err
 	}
 
-	// Save the extracted data
-	err = os.WriteFile(a.outputPath.Text, data, 0644)
+	profile, err := stego.NewProfile("", a.algorithm.Selected, config)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to save extracted data: %w", err), a.window)
-		return
+		return nil, err
+	}
+	profile.Mode = profileModes[a.embedMode.Selected]
+	if profile.Mode == stego.ModeShare {
+		profile.ShareThreshold, err = strconv.Atoi(a.shareThreshold.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold value: %w", err)
+		}
 	}
+	profile.Encryption = profileEncryptions[a.encryptionMode.Selected]
+	if profile.Encryption == stego.EncryptionRecipients {
+		profile.Recipients = append([]string(nil), a.recipientPaths...)
+	}
+	profile.SigningKey = a.signingKeyPath.Text
+	profile.Keyring = a.keyringPath.Text
 
-	dialog.ShowInformation("Успех", "Данные успешно извлечены", a.window)
+	return profile, profile.Validate()
 }
 
-func (a *StegoApp) calculateMetrics() {
-	originalPath := a.originalImagePath.Text
-	stegoPath := a.stegoImagePathForMetrics.Text
+// applyProfile fills both tabs with the settings of a profile
+func (a *StegoApp) applyProfile(profile *stego.Profile) {
+	info, _ := stego.Lookup(profile.Algorithm)
+	name := info.DisplayName(uiLanguage)
+	a.algorithm.SetSelected(name)
+	a.embedParams.SetParams(profile.Params)
+	a.extractAlgorithm.SetSelected(name)
+	a.extractParams.SetParams(profile.Params)
+	a.embeddingRate.SetValue(profile.EmbeddingRate)
+	a.embedRegion.SetText(profile.Region)
+	a.extractRegion.SetText(profile.Region)
+
+	for label, mode := range profileModes {
+		if mode == profile.Mode {
+			a.embedMode.SetSelected(label)
+		}
+	}
+	if profile.Mode == stego.ModeShare {
+		a.shareThreshold.SetText(strconv.Itoa(profile.ShareThreshold))
+	}
+	for label, encryption := range profileEncryptions {
+		if encryption == profile.Encryption {
+			a.encryptionMode.SetSelected(label)
+		}
+	}
+	a.recipientPaths = append([]string(nil), profile.Recipients...)
+	a.recipientList.Refresh()
+	a.signingKeyPath.SetText(profile.SigningKey)
+	a.keyringPath.SetText(profile.Keyring)
+}
 
-	if originalPath == "" || stegoPath == "" {
-		dialog.ShowError(errors.New("please select both original and stego images"), a.window)
+// saveProfile writes the current settings to a profile file chosen by the user
+func (a *StegoApp) saveProfile() {
+	profile, err := a.currentProfile()
+	if err != nil {
+		dialog.ShowError(err, a.window)
 		return
 	}
 
-	originalImg, err := loadImage(originalPath)
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		_ = writer.Close()
+
+		path := writer.URI().Path()
+		profile.Name = strings.TrimSuffix(writer.URI().Name(), writer.URI().Extension())
+		if err := stego.SaveProfile(path, profile); err != nil {
+			dialog.ShowError(fmt.Errorf("failed to save profile: %w", err), a.window)
+			return
+		}
+		dialog.ShowInformation("Успех", "Профиль сохранён: "+path, a.window)
+	}, a.window)
+}
+
+// loadProfile applies a profile file chosen by the user
+func (a *StegoApp) loadProfile() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		_ = reader.Close()
+
+		profile, err := stego.LoadProfile(reader.URI().Path())
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to load profile: %w", err), a.window)
+			return
+		}
+		a.applyProfile(profile)
+	}, a.window)
+}
+
+// rememberProfile stores the current settings so the next launch starts with them
+func (a *StegoApp) rememberProfile() {
+	profile, err := a.currentProfile()
+	if err != nil {
+		return
+	}
+	data, err := stego.MarshalProfile(profile, stego.FormatJSON)
 	if err != nil {
-		dialog.ShowError(err, a.window)
 		return
 	}
+	a.app.Preferences().SetString(lastProfileKey, string(data))
+}
 
-	stegoImg, err := loadImage(stegoPath)
+// restoreProfile applies the settings remembered by the last launch, if any
+func (a *StegoApp) restoreProfile() {
+	data := a.app.Preferences().String(lastProfileKey)
+	if data == "" {
+		return
+	}
+	profile, err := stego.UnmarshalProfile([]byte(data), stego.FormatJSON)
 	if err != nil {
-		dialog.ShowError(err, a.window)
 		return
 	}
+	a.applyProfile(profile)
+}
 
-	metrics := calculateImageMetrics(originalImg, stegoImg)
+// encryptOptions collects the encryption settings of the embed tab
+func (a *StegoApp) encryptOptions() (stego.EncryptOptions, error) {
+	var opts stego.EncryptOptions
 
-	// Display metrics
-	metricsText := ""
-	for name, value := range metrics {
-		metricsText += fmt.Sprintf("%s: %.4f\n", name, value)
+	switch a.encryptionMode.Selected {
+	case EncryptionPassword:
+		if a.embedPassword.Text == "" {
+			return opts, errors.New("please enter a password")
+		}
+		opts.Password = a.embedPassword.Text
+	case EncryptionRecipients:
+		if len(a.recipientPaths) == 0 {
+			return opts, errors.New("please add recipient public keys")
+		}
+		for _, path := range a.recipientPaths {
+			key, err := stego.LoadRecipientKey(path)
+			if err != nil {
+				return opts, fmt.Errorf("failed to load public key: %w", err)
+			}
+			opts.Recipients = append(opts.Recipients, key)
+		}
 	}
-	a.metricsText.SetText(metricsText)
+
+	return opts, nil
 }
 
-// Helper functions
+// decryptOptions collects the password and private key of the extract tab
+func (a *StegoApp) decryptOptions() (stego.DecryptOptions, error) {
+	opts := stego.DecryptOptions{Password: a.extractPassword.Text}
 
-func loadImage(path string) (image.Image, error) {
-	file, err := os.Open(path)
+	if a.identityPath.Text != "" {
+		key, err := stego.LoadIdentity(a.identityPath.Text)
+		if err != nil {
+			return opts, fmt.Errorf("failed to load private key: %w", err)
+		}
+		opts.Identities = append(opts.Identities, key)
+	}
+
+	return opts, nil
+}
+
+// extractRequest holds the settings of the extract tab, read on the UI thread before
+// the extraction runs in the background
+type extractRequest struct {
+	paths     []string
+	algorithm stego.Steganographer
+	config    stego.Config
+	deniable  bool
+	password  string
+	keyring   *stego.Keyring
+	decrypt   stego.DecryptOptions
+}
+
+// newExtractRequest collects the settings of the extract tab and loads the key files
+func (a *StegoApp) newExtractRequest() (*extractRequest, error) {
+	if a.stegoImagePath.Text == "" {
+		return nil, errors.New("please select a stego image")
+	}
+
+	// Create steganography config
+	config, err := a.buildConfig(a.extractAlgorithm.Selected, a.extractParams, a.extractRegion)
 	if err != nil {
 		return nil, err
 	}
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
 
-	img, _, err := image.Decode(file)
+	// Get the appropriate steganography algorithm
+	algorithm, err := stego.Factory(a.extractAlgorithm.Selected)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &extractRequest{
+		paths:     append([]string{a.stegoImagePath.Text}, a.extraStegoPaths...),
+		algorithm: algorithm,
+		config:    config,
+		deniable:  a.deniableExtract.Checked,
+		password:  a.extractPassword.Text,
+	}
+
+	if a.keyringPath.Text != "" {
+		req.keyring, err = stego.LoadKeyring(a.keyringPath.Text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keyring: %w", err)
+		}
+	}
+
+	req.decrypt, err = a.decryptOptions()
 	if err != nil {
 		return nil, err
 	}
+	return req, nil
+}
+
+// payload reads the stego images and returns the hidden payload together with its signature, if any
+func (r *extractRequest) payload(ctx context.Context, progress stego.Progress) ([]byte, *stego.SignatureInfo, error) {
+	data, err := r.raw(ctx, progress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Verify the signature against the keyring
+	data, signature, err := stego.VerifySignature(data, r.keyring)
+	if err != nil {
+		return nil, signature, err
+	}
 
-	return img, nil
+	// Decrypt the data if it is encrypted
+	data, err = stego.Decrypt(data, r.decrypt)
+	return data, signature, err
 }
 
-func saveImage(path string, img image.Image) error {
-	file, err := os.Create(path)
+// raw reads the stego images and returns the embedded container
+func (r *extractRequest) raw(ctx context.Context, progress stego.Progress) ([]byte, error) {
+	// Load the stego images, keeping all frames of the first one
+	images := make([]image.Image, len(r.paths))
+	var frames []image.Image
+	for i, path := range r.paths {
+		anim, err := imageio.LoadAnimation(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stego image %s: %w", path, err)
+		}
+		images[i] = anim.Frames[0].Image
+		if i == 0 {
+			frames = anim.Images()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Deniable images hold whichever payload the password unlocks
+	if r.deniable {
+		deniable, ok := r.algorithm.(stego.DeniableSteganographer)
+		if !ok {
+			return nil, fmt.Errorf("algorithm %s does not support deniable embedding", algorithmDisplayName(r.algorithm))
+		}
+		return deniable.ExtractDeniable(images[0], r.password, r.config)
+	}
+
+	if len(images) > 1 {
+		// Reassemble a split payload from all pieces
+		data, err := stego.Join(r.algorithm, images, r.config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to join pieces: %w", err)
+		}
+		return data, nil
+	}
+
+	if len(frames) > 1 {
+		// Reassemble the pieces spread over the frames of an animation
+		data, err := stego.ExtractFrames(ctx, r.algorithm, frames, r.config, progress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract data: %w", err)
+		}
+		return data, nil
+	}
+
+	// Extract the data
+	data, err := stego.ExtractContext(ctx, r.algorithm, images[0], r.config, progress)
 	if err != nil {
+		return nil, fmt.Errorf("failed to extract data: %w", err)
+	}
+	return stego.OpenPayload(data)
+}
+
+// detectParams finds the algorithm and parameters of the stego image and fills them into the form
+func (a *StegoApp) detectParams() {
+	if a.stegoImagePath.Text == "" {
+		dialog.ShowError(errors.New("please select a stego image"), a.window)
+		return
+	}
+
+	region, err := stego.ParseRegion(a.extractRegion.Text)
+	if err != nil {
+		dialog.ShowError(err, a.window)
+		return
+	}
+
+	// The parameters currently in the form are tried first
+	var stored []stego.Params
+	if params, err := a.extractParams.Params(); err == nil {
+		stored = append(stored, params)
+	}
+
+	stegoPath := a.stegoImagePath.Text
+	var detection *stego.Detection
+	a.runTask("Определение параметров", func(ctx context.Context, progress stego.Progress) error {
+		anim, err := imageio.LoadAnimation(stegoPath)
+		if err != nil {
+			return fmt.Errorf("failed to load stego image: %w", err)
+		}
+		detection, err = stego.DetectFrames(ctx, anim.Images(), region, stored, progress)
 		return err
+	}, func() {
+		info, _ := stego.Lookup(detection.Algorithm)
+		a.extractAlgorithm.SetSelected(info.DisplayName(uiLanguage))
+		a.extractParams.SetParams(detection.Config.Params)
+
+		dialog.ShowInformation("Параметры определены", detection.String(), a.window)
+	})
+}
+
+// signatureText describes the payload signature for the user
+func signatureText(info *stego.SignatureInfo) string {
+	switch {
+	case info == nil:
+		return "Данные не подписаны"
+	case info.Verified:
+		return fmt.Sprintf("Подписано: %s (%s), подпись верна", info.Signer, info.Fingerprint)
+	default:
+		return fmt.Sprintf("Подписано неизвестным ключом %s, подпись не проверена", info.Fingerprint)
 	}
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
+}
+
+func (a *StegoApp) listArchive() {
+	req, err := a.newExtractRequest()
+	if err != nil {
+		dialog.ShowError(err, a.window)
+		return
+	}
+
+	var data []byte
+	var signature *stego.SignatureInfo
+	var entries []stego.ArchiveEntry
+	a.runTask("Чтение содержимого", func(ctx context.Context, progress stego.Progress) error {
+		var err error
+		data, signature, err = req.payload(ctx, progress)
+		if err != nil || !stego.IsArchive(data) {
+			return err
+		}
+		entries, err = stego.ListArchive(data)
+		return err
+	}, func() {
+		if !stego.IsArchive(data) {
+			a.archiveEntries.Options = nil
+			a.archiveEntries.Refresh()
+			dialog.ShowInformation("Содержимое", fmt.Sprintf("Скрыт один файл размером %d байт\n%s",
+				len(data), signatureText(signature)), a.window)
+			return
+		}
+
+		options := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			options = append(options, entry.Name)
+		}
+		a.archiveEntries.Options = options
+		a.archiveEntries.Selected = nil
+		a.archiveEntries.Refresh()
+	})
+}
+
+func (a *StegoApp) extractData() {
+	// Check if all required fields are filled
+	if a.extractOutputPath.Text == "" {
+		dialog.ShowError(errors.New("please specify an output path"), a.window)
+		return
+	}
+
+	req, err := a.newExtractRequest()
+	if err != nil {
+		dialog.ShowError(err, a.window)
+		return
+	}
+
+	outputPath := a.extractOutputPath.Text
+	selected := append([]string(nil), a.archiveEntries.Selected...)
+	var message string
+	a.runTask("Извлечение данных", func(ctx context.Context, progress stego.Progress) error {
+		data, signature, err := req.payload(ctx, progress)
+		if err != nil {
+			return err
+		}
+
+		// Unpack archives into the output directory
+		if stego.IsArchive(data) {
+			written, err := stego.ExtractArchive(data, outputPath, selected)
+			if err != nil {
+				return fmt.Errorf("failed to extract archive: %w", err)
+			}
+			message = "Извлечены файлы:\n" + strings.Join(written, "\n") + "\n" + signatureText(signature)
+			return nil
+		}
 
-	return png.Encode(file, img)
+		// Save the extracted data
+		if err := os.WriteFile(outputPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to save extracted data: %w", err)
+		}
+		message = "Данные успешно извлечены\n" + signatureText(signature)
+		return nil
+	}, func() {
+		dialog.ShowInformation("Успех", message, a.window)
+	})
 }
 
-func calculateImageMetrics(original, stego image.Image) map[string]float64 {
+func (a *StegoApp) calculateMetrics() {
+	originalPath := a.originalImagePath.Text
+	stegoPath := a.stegoImagePathForMetrics.Text
+
+	if originalPath == "" || stegoPath == "" {
+		dialog.ShowError(errors.New("please select both original and stego images"), a.window)
+		return
+	}
+
+	var metrics map[string]float64
+	a.runTask("Расчёт метрик", func(ctx context.Context, progress stego.Progress) error {
+		originalImg, err := imageio.Load(originalPath)
+		if err != nil {
+			return err
+		}
+
+		stegoImg, err := imageio.Load(stegoPath)
+		if err != nil {
+			return err
+		}
+
+		metrics, err = calculateImageMetrics(ctx, originalImg, stegoImg, progress)
+		return err
+	}, func() {
+		// Display metrics
+		metricsText := ""
+		for name, value := range metrics {
+			metricsText += fmt.Sprintf("%s: %.4f\n", name, value)
+		}
+		a.metricsText.SetText(metricsText)
+	})
+}
+
+// Helper functions
+
+// calculateImageMetrics compares the images in two passes over the rows,
+// checking ctx and reporting progress after every row
+func calculateImageMetrics(ctx context.Context, original, stegoImage image.Image, progress stego.Progress) (map[string]float64, error) {
 	metrics := make(map[string]float64)
 
 	bounds := original.Bounds()
+	if bounds.Size() != stegoImage.Bounds().Size() {
+		return nil, fmt.Errorf("images differ in size: %dx%d and %dx%d", bounds.Dx(), bounds.Dy(),
+			stegoImage.Bounds().Dx(), stegoImage.Bounds().Dy())
+	}
 	totalPixels := bounds.Dx() * bounds.Dy()
 
+	// The stego image is read at the same offset from its own origin, which may differ
+	origAt, stegoRead := stego.RGBAReader(original), stego.RGBAReader(stegoImage)
+	shift := stegoImage.Bounds().Min.Sub(bounds.Min)
+	stegoAt := func(x, y int) color.RGBA {
+		return stegoRead(x+shift.X, y+shift.Y)
+	}
+
+	rows := 0
+	nextRow := func() error {
+		rows++
+		progress.Report(float64(rows) / float64(2*bounds.Dy()))
+		return ctx.Err()
+	}
+
 	// MSE and PSNR
 	var mseR, mseG, mseB float64
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if err := nextRow(); err != nil {
+			return nil, err
+		}
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			orig := color.RGBAModel.Convert(original.At(x, y)).(color.RGBA)
-			steg := color.RGBAModel.Convert(stego.At(x, y)).(color.RGBA)
+			orig := origAt(x, y)
+			steg := stegoAt(x, y)
 
 			diffR := float64(orig.R) - float64(steg.R)
 			diffG := float64(orig.G) - float64(steg.G)
@@ -552,9 +1576,12 @@ func calculateImageMetrics(original, stego image.Image) map[string]float64 {
 	var sumProdR, sumProdG, sumProdB float64
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if err := nextRow(); err != nil {
+			return nil, err
+		}
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			orig := color.RGBAModel.Convert(original.At(x, y)).(color.RGBA)
-			steg := color.RGBAModel.Convert(stego.At(x, y)).(color.RGBA)
+			orig := origAt(x, y)
+			steg := stegoAt(x, y)
 
 			or := float64(orig.R)
 			og := float64(orig.G)
@@ -596,7 +1623,94 @@ func calculateImageMetrics(original, stego image.Image) map[string]float64 {
 	metrics["Correlation (B)"] = corrB
 	metrics["Correlation (Avg)"] = (corrR + corrG + corrB) / 3
 
-	return metrics
+	return metrics, nil
+}
+
+// paramForm is an input form generated from the parameter schema of the selected algorithm
+type paramForm struct {
+	box    *fyne.Container
+	schema stego.Schema
+	inputs map[string]paramInput
+}
+
+// paramInput reads and writes the text of one parameter widget
+type paramInput struct {
+	get func() string
+	set func(string)
+}
+
+func newParamForm() *paramForm {
+	return &paramForm{box: container.NewVBox()}
+}
+
+// SetAlgorithm rebuilds the form for the algorithm with the given display name, filled with the defaults
+func (f *paramForm) SetAlgorithm(name string) {
+	info, _ := stego.Lookup(name)
+	f.schema = info.Schema
+	f.inputs = make(map[string]paramInput, len(f.schema))
+
+	form := widget.NewForm()
+	for _, spec := range f.schema {
+		var input paramInput
+		var w fyne.CanvasObject
+
+		if spec.Kind == stego.ParamEnum {
+			labels := make([]string, len(spec.Choices))
+			for i, choice := range spec.Choices {
+				labels[i] = spec.ChoiceLabel(choice.Value, uiLanguage)
+			}
+			sel := widget.NewSelect(labels, nil)
+			input = paramInput{
+				get: func() string { return sel.Selected },
+				set: func(v string) { sel.SetSelected(spec.ChoiceLabel(v, uiLanguage)) },
+			}
+			w = sel
+		} else {
+			entry := widget.NewEntry()
+			if spec.Secret {
+				entry = widget.NewPasswordEntry()
+			}
+			entry.Validator = func(text string) error {
+				_, err := spec.Parse(text)
+				return err
+			}
+			input = paramInput{get: func() string { return entry.Text }, set: entry.SetText}
+			w = entry
+		}
+
+		input.set(spec.FormatValue(spec.Default))
+		f.inputs[spec.Name] = input
+		form.AppendItem(&widget.FormItem{Text: spec.Label(uiLanguage), Widget: w, HintText: spec.HelpText(uiLanguage)})
+	}
+
+	f.box.Objects = nil
+	if len(f.schema) > 0 {
+		f.box.Add(widget.NewLabel("Параметры алгоритма:"))
+		f.box.Add(form)
+	}
+	f.box.Refresh()
+}
+
+// Params parses and validates the values entered into the form
+func (f *paramForm) Params() (stego.Params, error) {
+	params := make(stego.Params, len(f.schema))
+	for _, spec := range f.schema {
+		v, err := spec.Parse(f.inputs[spec.Name].get())
+		if err != nil {
+			return nil, err
+		}
+		params[spec.Name] = v
+	}
+	return params, nil
+}
+
+// SetParams fills the form with the given parameter values
+func (f *paramForm) SetParams(params stego.Params) {
+	for _, spec := range f.schema {
+		if v, ok := params[spec.Name]; ok {
+			f.inputs[spec.Name].set(spec.FormatValue(v))
+		}
+	}
 }
 
 func main() {
@@ -0,0 +1,131 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// translucentNRGBA returns a random non-premultiplied image in which a quarter of the
+// pixels are fully transparent and the rest have random alpha
+func translucentNRGBA(width, height int, seed int64) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rnd.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		if rnd.Intn(4) == 0 {
+			img.Pix[i] = 0
+		} else {
+			img.Pix[i] = byte(1 + rnd.Intn(255))
+		}
+	}
+	return img
+}
+
+// pngRoundTrip encodes and decodes the image as PNG
+func pngRoundTrip(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	decoded, err := png.Decode(&buf)
+	require.NoError(t, err)
+	return decoded
+}
+
+// TestTranslucentCover tests embedding into translucent covers of several formats
+func TestTranslucentCover(t *testing.T) {
+	t.Parallel()
+
+	nrgba := translucentNRGBA(200, 150, 3)
+
+	// The same picture premultiplied
+	rgba := image.NewRGBA(nrgba.Bounds())
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			rgba.Set(x, y, nrgba.At(x, y))
+		}
+	}
+
+	paletted := image.NewPaletted(nrgba.Bounds(), color.Palette{
+		color.NRGBA{}, color.NRGBA{R: 200, G: 10, B: 77, A: 128}, color.NRGBA{R: 3, G: 250, B: 140, A: 255},
+	})
+	rnd := rand.New(rand.NewSource(4))
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(rnd.Intn(3))
+	}
+
+	s := NewFractalStego()
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+	data := []byte("hidden behind the glass")
+
+	for name, cover := range map[string]image.Image{"NRGBA": nrgba, "RGBA": rgba, "Paletted": paletted} {
+		stegoImage, err := s.Embed(cover, data, config)
+		require.NoError(t, err, name)
+		require.IsType(t, &image.NRGBA{}, stegoImage, name)
+
+		// Alpha is untouched and fully transparent pixels are left alone entirely
+		b := cover.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				before := color.NRGBAModel.Convert(cover.At(x, y)).(color.NRGBA)
+				after := stegoImage.(*image.NRGBA).NRGBAAt(x, y)
+				require.Equal(t, before.A, after.A, "%s alpha at %d,%d", name, x, y)
+				if before.A == 0 {
+					require.Equal(t, before, after, "%s transparent pixel at %d,%d", name, x, y)
+				}
+			}
+		}
+
+		extracted, err := s.Extract(pngRoundTrip(t, stegoImage), config)
+		require.NoError(t, err, name)
+		assert.Equal(t, data, extracted, name)
+	}
+}
+
+// TestTransparentPixelsCleared tests that the payload survives tools that zero the color
+// of fully transparent pixels
+func TestTransparentPixelsCleared(t *testing.T) {
+	t.Parallel()
+
+	cover := translucentNRGBA(200, 150, 5)
+	s := NewFractalStego()
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Julia", Iterations: 100, Threshold: 2}.Params()}
+	data := []byte("survives optimizers")
+
+	stegoImage, err := s.Embed(cover, data, config)
+	require.NoError(t, err)
+
+	cleared := stegoImage.(*image.NRGBA)
+	for i := 0; i < len(cleared.Pix); i += 4 {
+		if cleared.Pix[i+3] == 0 {
+			cleared.Pix[i], cleared.Pix[i+1], cleared.Pix[i+2] = 0, 0, 0
+		}
+	}
+
+	extracted, err := s.Extract(pngRoundTrip(t, cleared), config)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+}
+
+// TestTranslucentDeniable tests deniable embedding into a translucent cover
+func TestTranslucentDeniable(t *testing.T) {
+	t.Parallel()
+
+	cover := translucentNRGBA(300, 200, 6)
+	s := NewFractalStego()
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+
+	stegoImage, err := s.EmbedDeniable(cover, []byte("decoy"), "decoy key", nil, "", config)
+	require.NoError(t, err)
+
+	extracted, err := s.ExtractDeniable(pngRoundTrip(t, stegoImage), "decoy key", config)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("decoy"), extracted)
+}
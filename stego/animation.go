@@ -0,0 +1,126 @@
+package stego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// ErrNoCarrierFrames is returned when no frame of an animation can hold a piece of the payload
+var ErrNoCarrierFrames = errors.New("no frame of the animation can hold a piece of the payload")
+
+// EmbedFrames spreads data over the frames of an animation the way Split spreads it over
+// covers: every frame is a cover of its own, with the mask of its own size and position, and
+// carries a piece with a payload header. Frames too small to hold a header are returned unchanged.
+func EmbedFrames(ctx context.Context, alg Steganographer, frames []image.Image, data []byte, config Config, progress Progress) ([]image.Image, error) {
+	if len(frames) > math.MaxUint16 {
+		return nil, fmt.Errorf("too many frames: %d", len(frames))
+	}
+
+	var carriers []int
+	var capacities []int
+	total := 0
+	var firstErr error
+	for i, frame := range frames {
+		c, err := alg.Capacity(frame, config)
+		if err != nil {
+			// A region may not fit into small frames, which then carry nothing
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if c <= PayloadHeaderSize {
+			continue
+		}
+		carriers = append(carriers, i)
+		capacities = append(capacities, c-PayloadHeaderSize)
+		total += c - PayloadHeaderSize
+	}
+	if len(carriers) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ErrNoCarrierFrames
+	}
+	if len(data) > total {
+		return nil, fmt.Errorf("payload is %d bytes, the frames can hold only %d bytes", len(data), total)
+	}
+
+	sizes := splitSizes(len(data), capacities, total)
+	setID, err := NewSetID()
+	if err != nil {
+		return nil, err
+	}
+
+	images := append([]image.Image(nil), frames...)
+	offset := 0
+	for n, i := range carriers {
+		header := PayloadHeader{SetID: setID, Seq: uint16(n), Total: uint16(len(carriers))}
+		piece := EncodePayload(header, data[offset:offset+sizes[n]])
+		offset += sizes[n]
+
+		img, err := EmbedContext(ctx, alg, frames[i], piece, config, frameProgress(progress, n, len(carriers)))
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i+1, err)
+		}
+		images[i] = img
+	}
+
+	return images, nil
+}
+
+// ExtractFrames reassembles the payload hidden by EmbedFrames, skipping the frames that
+// carry no piece. Frames lost since embedding are reported as a *MissingPiecesError.
+func ExtractFrames(ctx context.Context, alg Steganographer, frames []image.Image, config Config, progress Progress) ([]byte, error) {
+	payloads := make([][]byte, len(frames))
+	for i, frame := range frames {
+		data, err := ExtractContext(ctx, alg, frame, config, frameProgress(progress, i, len(frames)))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			continue
+		}
+		if _, _, err := DecodePayload(data); err != nil {
+			continue
+		}
+		payloads[i] = data
+	}
+
+	return joinPayloads(payloads)
+}
+
+// DetectFrames runs DetectContext on the region of every frame in turn and returns the first
+// detection, so that animations whose first frames carry nothing are still detected
+func DetectFrames(ctx context.Context, frames []image.Image, region image.Rectangle, stored []Params, progress Progress) (*Detection, error) {
+	err := ErrNotDetected
+	for n, frame := range frames {
+		img, cropErr := CropRegion(frame, region)
+		if cropErr != nil {
+			err = cropErr
+			continue
+		}
+		detection, detectErr := DetectContext(ctx, img, stored, frameProgress(progress, n, len(frames)))
+		if detectErr == nil {
+			return detection, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		err = detectErr
+	}
+	return nil, err
+}
+
+// frameProgress maps the progress of frame n of total onto its equal share of the whole
+func frameProgress(progress Progress, n, total int) Progress {
+	if progress == nil {
+		return nil
+	}
+	return ProgressFunc(func(done float64) {
+		progress.Report((float64(n) + done) / float64(total))
+	})
+}
@@ -0,0 +1,92 @@
+package stego
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFramesRoundTrip tests that a payload spread over frames of different sizes and
+// positions comes back whole, and that frames too small to carry a piece are left alone
+func TestFramesRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	frames := []image.Image{
+		translucentNRGBA(200, 150, 11),
+		translucentNRGBA(4, 4, 12).SubImage(image.Rect(1, 1, 3, 3)),
+		translucentNRGBA(300, 200, 13).SubImage(image.Rect(40, 30, 220, 150)),
+		randomPaletted(120, 90, 14),
+	}
+	s := NewFractalStego()
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+	data := bytes.Repeat([]byte("frame by frame "), 60)
+
+	var reported []float64
+	progress := ProgressFunc(func(done float64) { reported = append(reported, done) })
+
+	stegoFrames, err := EmbedFrames(context.Background(), s, frames, data, config, progress)
+	require.NoError(t, err)
+	require.Len(t, stegoFrames, len(frames))
+	assert.Same(t, frames[1], stegoFrames[1], "a frame without room for a piece must not change")
+	for i, frame := range stegoFrames {
+		assert.Equal(t, frames[i].Bounds(), frame.Bounds(), "frame %d", i)
+	}
+	require.NotEmpty(t, reported)
+	assert.InDelta(t, 1.0, reported[len(reported)-1], 1e-9)
+
+	extracted, err := ExtractFrames(context.Background(), s, stegoFrames, config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+
+	// A dropped frame is reported as a missing piece
+	_, err = ExtractFrames(context.Background(), s, append(stegoFrames[:2:2], stegoFrames[3]), config, nil)
+	var missing *MissingPiecesError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, []int{2}, missing.Missing)
+}
+
+// TestFramesTooLarge tests that a payload larger than all frames together is refused
+func TestFramesTooLarge(t *testing.T) {
+	t.Parallel()
+
+	frames := []image.Image{translucentNRGBA(60, 40, 15), translucentNRGBA(60, 40, 16)}
+	s := NewFractalStego()
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+
+	_, err := EmbedFrames(context.Background(), s, frames, make([]byte, 10000), config, nil)
+	assert.Error(t, err)
+
+	_, err = EmbedFrames(context.Background(), s, frames[:0], []byte("x"), config, nil)
+	assert.ErrorIs(t, err, ErrNoCarrierFrames)
+}
+
+// TestFramesKeepPalette tests that only algorithms registered as keeping the palette return
+// paletted frames for a paletted animation, which is what GIF output needs
+func TestFramesKeepPalette(t *testing.T) {
+	t.Parallel()
+
+	frames := []image.Image{randomPaletted(120, 90, 17), randomPaletted(120, 90, 18)}
+	data := bytes.Repeat([]byte("gif "), 100)
+	for _, id := range []string{"fractal", "palette"} {
+		info, ok := Lookup(id)
+		require.True(t, ok)
+		params, err := info.Schema.Resolve(nil)
+		require.NoError(t, err)
+		config := Config{EmbeddingRate: 1, Params: params}
+
+		stegoFrames, err := EmbedFrames(context.Background(), info.New(), frames, data, config, nil)
+		require.NoError(t, err, id)
+		for i, frame := range stegoFrames {
+			_, paletted := frame.(*image.Paletted)
+			assert.Equal(t, info.KeepsPalette, paletted, "%s frame %d", id, i)
+		}
+
+		extracted, err := ExtractFrames(context.Background(), info.New(), stegoFrames, config, nil)
+		require.NoError(t, err, id)
+		assert.Equal(t, data, extracted, id)
+	}
+}
@@ -0,0 +1,282 @@
+package stego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// archiveMagic marks payloads that carry several files instead of raw data
+const archiveMagic = "STGARC1\x00"
+
+// ArchiveEntry describes a single file stored in a payload archive
+type ArchiveEntry struct {
+	// Name is the slash-separated path of the file inside the archive
+	Name string
+	// Size is the length of the file contents in bytes
+	Size int64
+	// Mode holds the permission bits of the original file
+	Mode fs.FileMode
+}
+
+// PackPaths builds a payload from the given files and directories.
+// A single regular file is returned as is, anything else is packed into an archive.
+func PackPaths(paths []string) ([]byte, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no files to pack")
+	}
+
+	if len(paths) == 1 {
+		info, err := os.Stat(paths[0])
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().IsRegular() {
+			return os.ReadFile(paths[0])
+		}
+	}
+
+	return BuildArchive(paths)
+}
+
+// BuildArchive packs the given files and directories into a payload archive.
+// Directories are added recursively under their own base name.
+//
+// The archive is the magic followed by entries of the form
+// uvarint(len(name)) name uvarint(mode) uvarint(size) data.
+func BuildArchive(paths []string) ([]byte, error) {
+	buf := bytes.NewBufferString(archiveMagic)
+	seen := make(map[string]bool)
+
+	addFile := func(filePath, name string, info fs.FileInfo) error {
+		if seen[name] {
+			return fmt.Errorf("duplicate archive entry: %s", name)
+		}
+		seen[name] = true
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(binary.AppendUvarint(nil, uint64(len(name))))
+		buf.WriteString(name)
+		buf.Write(binary.AppendUvarint(nil, uint64(info.Mode().Perm())))
+		buf.Write(binary.AppendUvarint(nil, uint64(len(data))))
+		buf.Write(data)
+		return nil
+	}
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			if err := addFile(p, filepath.Base(p), info); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		root := filepath.Dir(filepath.Clean(p))
+		err = filepath.WalkDir(p, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, filePath)
+			if err != nil {
+				return err
+			}
+			return addFile(filePath, filepath.ToSlash(rel), info)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(seen) == 0 {
+		return nil, errors.New("no files to pack")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// IsArchive reports whether the payload is a multi-file archive
+func IsArchive(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(archiveMagic))
+}
+
+// ListArchive returns the entries of a payload archive without extracting them
+func ListArchive(data []byte) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+	err := walkArchive(data, func(entry ArchiveEntry, _ []byte) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ExtractArchive writes the selected entries of a payload archive into dir.
+// An empty selection extracts everything; a directory name selects all files below it.
+// Files are written through an os.Root, so symbolic links already in dir cannot lead
+// outside of it. It returns the paths of the written files.
+func ExtractArchive(data []byte, dir string, names []string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	matched := make([]bool, len(names))
+	selected := func(name string) bool {
+		if len(names) == 0 {
+			return true
+		}
+		found := false
+		for i, n := range names {
+			n = strings.TrimSuffix(n, "/")
+			if name == n || strings.HasPrefix(name, n+"/") {
+				matched[i] = true
+				found = true
+			}
+		}
+		return found
+	}
+
+	var written []string
+	err = walkArchive(data, func(entry ArchiveEntry, content []byte) error {
+		if !selected(entry.Name) {
+			return nil
+		}
+
+		rel := filepath.FromSlash(entry.Name)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("unsafe archive entry name: %s", entry.Name)
+		}
+		if err := mkdirAllIn(root, filepath.Dir(rel)); err != nil {
+			return err
+		}
+
+		mode := entry.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		file, err := root.OpenFile(rel, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		written = append(written, filepath.Join(dir, rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, ok := range matched {
+		if !ok {
+			return written, fmt.Errorf("archive entry not found: %s", names[i])
+		}
+	}
+
+	return written, nil
+}
+
+// walkArchive calls fn for every entry in the archive, rejecting unsafe names
+func walkArchive(data []byte, fn func(entry ArchiveEntry, content []byte) error) error {
+	if !IsArchive(data) {
+		return errors.New("payload is not an archive")
+	}
+
+	rest := data[len(archiveMagic):]
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return 0, errors.New("corrupted archive")
+		}
+		rest = rest[n:]
+		return v, nil
+	}
+
+	for len(rest) > 0 {
+		nameLen, err := readUvarint()
+		if err != nil {
+			return err
+		}
+		if nameLen > uint64(len(rest)) {
+			return errors.New("corrupted archive")
+		}
+		name := string(rest[:nameLen])
+		rest = rest[nameLen:]
+
+		mode, err := readUvarint()
+		if err != nil {
+			return err
+		}
+		size, err := readUvarint()
+		if err != nil {
+			return err
+		}
+		if size > uint64(len(rest)) {
+			return errors.New("corrupted archive")
+		}
+		content := rest[:size]
+		rest = rest[size:]
+
+		// Backslashes and colons are separators and volume names on Windows, so they could
+		// reach outside the destination even in a valid slash-separated path
+		if !fs.ValidPath(name) || path.Clean(name) != name || name == "." || strings.ContainsAny(name, `\:`) {
+			return fmt.Errorf("unsafe archive entry name: %s", name)
+		}
+
+		entry := ArchiveEntry{Name: name, Size: int64(size), Mode: fs.FileMode(mode).Perm()}
+		if err := fn(entry, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mkdirAllIn creates the directory rel and its missing parents inside root
+func mkdirAllIn(root *os.Root, rel string) error {
+	if rel == "." {
+		return nil
+	}
+	if err := mkdirAllIn(root, filepath.Dir(rel)); err != nil {
+		return err
+	}
+	if err := root.Mkdir(rel, 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
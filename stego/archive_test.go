@@ -0,0 +1,173 @@
+package stego
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestTree creates a small directory tree with a few files
+func writeTestTree(t *testing.T) (string, map[string]string) {
+	root := t.TempDir()
+	files := map[string]string{
+		"docs/a.txt":        "first file",
+		"docs/nested/b.txt": "second file",
+		"single.bin":        "\x00\x01\x02 binary",
+	}
+
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+
+	return root, files
+}
+
+// TestArchiveRoundTrip tests packing files and directories and extracting them back
+func TestArchiveRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root, files := writeTestTree(t)
+
+	data, err := BuildArchive([]string{
+		filepath.Join(root, "docs"),
+		filepath.Join(root, "single.bin"),
+	})
+	require.NoError(t, err)
+	assert.True(t, IsArchive(data))
+
+	entries, err := ListArchive(data)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+		assert.Equal(t, int64(len(files[e.Name])), e.Size)
+	}
+	assert.ElementsMatch(t, []string{"docs/a.txt", "docs/nested/b.txt", "single.bin"}, names)
+
+	out := t.TempDir()
+	written, err := ExtractArchive(data, out, nil)
+	require.NoError(t, err)
+	assert.Len(t, written, 3)
+
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(got))
+	}
+}
+
+// TestArchiveSelectiveExtract tests extracting only selected entries
+func TestArchiveSelectiveExtract(t *testing.T) {
+	t.Parallel()
+
+	root, _ := writeTestTree(t)
+
+	data, err := BuildArchive([]string{filepath.Join(root, "docs"), filepath.Join(root, "single.bin")})
+	require.NoError(t, err)
+
+	out := t.TempDir()
+	written, err := ExtractArchive(data, out, []string{"docs/nested"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(out, "docs", "nested", "b.txt")}, written)
+
+	_, err = os.Stat(filepath.Join(out, "single.bin"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = ExtractArchive(data, out, []string{"missing.txt"})
+	assert.Error(t, err)
+}
+
+// TestPackPathsSingleFile tests that a single file is embedded without archive overhead
+func TestPackPathsSingleFile(t *testing.T) {
+	t.Parallel()
+
+	root, files := writeTestTree(t)
+
+	data, err := PackPaths([]string{filepath.Join(root, "single.bin")})
+	require.NoError(t, err)
+	assert.False(t, IsArchive(data))
+	assert.Equal(t, files["single.bin"], string(data))
+
+	data, err = PackPaths([]string{filepath.Join(root, "docs")})
+	require.NoError(t, err)
+	assert.True(t, IsArchive(data))
+}
+
+// TestArchiveEmbedExtract tests that an archive survives embedding into an image
+func TestArchiveEmbedExtract(t *testing.T) {
+	t.Parallel()
+
+	root, _ := writeTestTree(t)
+	data, err := BuildArchive([]string{filepath.Join(root, "docs")})
+	require.NoError(t, err)
+
+	config := Config{
+		EmbeddingRate: 0.5,
+		Params:        FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2.0}.Params(),
+	}
+
+	stego := NewFractalStego()
+	stegoImg, err := stego.Embed(createTestImage(300, 300), data, config)
+	require.NoError(t, err)
+
+	extracted, err := stego.Extract(stegoImg, config)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+
+	entries, err := ListArchive(extracted)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+// TestArchiveUnsafeNames tests that entries which could escape the destination are rejected
+func TestArchiveUnsafeNames(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"../x", "/etc/x", `..\..\x`, `docs\..\..\x`, "C:x", "c:/x"} {
+		data := []byte(archiveMagic)
+		data = binary.AppendUvarint(data, uint64(len(name)))
+		data = append(data, name...)
+		data = binary.AppendUvarint(data, 0644)
+		data = binary.AppendUvarint(data, 1)
+		data = append(data, 'x')
+
+		out := t.TempDir()
+		_, err := ExtractArchive(data, out, nil)
+		assert.Error(t, err, name)
+		_, err = ListArchive(data)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestArchiveSymlinkEscape tests that symbolic links planted in the destination are not followed outside of it
+func TestArchiveSymlinkEscape(t *testing.T) {
+	t.Parallel()
+
+	outside := t.TempDir()
+	out := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(out, "docs")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "file.txt"), filepath.Join(out, "file.txt")))
+
+	for _, name := range []string{"docs/x.txt", "file.txt"} {
+		data := []byte(archiveMagic)
+		data = binary.AppendUvarint(data, uint64(len(name)))
+		data = append(data, name...)
+		data = binary.AppendUvarint(data, 0644)
+		data = binary.AppendUvarint(data, 1)
+		data = append(data, 'x')
+
+		_, err := ExtractArchive(data, out, nil)
+		assert.Error(t, err, name)
+	}
+
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,73 @@
+package stego
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// errBitCapacity is returned when data does not fit into the bits left in a bitWriter
+var errBitCapacity = errors.New("data exceeds the available bits")
+
+// bitWriter writes bytes most significant bit first, passing every bit with its index to set.
+// It never writes more than capacity bits, so callers do not need to expand bytes into bits.
+type bitWriter struct {
+	set      func(i int, bit byte)
+	capacity int
+	n        int
+}
+
+// Write stores p whole, or nothing with errBitCapacity when it does not fit
+func (w *bitWriter) Write(p []byte) (int, error) {
+	if len(p) > (w.capacity-w.n)/8 {
+		return 0, errBitCapacity
+	}
+	for _, b := range p {
+		for j := 7; j >= 0; j-- {
+			w.set(w.n, (b>>j)&1)
+			w.n++
+		}
+	}
+	return len(p), nil
+}
+
+// bitReader reads bytes most significant bit first, taking every bit with its index from get.
+// It returns io.EOF once fewer than 8 of its capacity bits are left.
+type bitReader struct {
+	get      func(i int) byte
+	capacity int
+	n        int
+}
+
+// Read fills p with as many whole bytes as are left
+func (r *bitReader) Read(p []byte) (int, error) {
+	left := (r.capacity - r.n) / 8
+	if left == 0 {
+		return 0, io.EOF
+	}
+
+	p = p[:min(len(p), left)]
+	for i := range p {
+		var b byte
+		for range 8 {
+			b = b<<1 | r.get(r.n)&1
+			r.n++
+		}
+		p[i] = b
+	}
+	return len(p), nil
+}
+
+// randomBits passes n random bits to set, drawing them a chunk of bytes at a time
+func randomBits(n int, set func(i int, bit byte)) error {
+	chunk := make([]byte, min(streamChunk, (n+7)/8))
+	for i := 0; i < n; i += len(chunk) * 8 {
+		if _, err := rand.Read(chunk); err != nil {
+			return err
+		}
+		for j := 0; j < len(chunk)*8 && i+j < n; j++ {
+			set(i+j, (chunk[j/8]>>(7-j%8))&1)
+		}
+	}
+	return nil
+}
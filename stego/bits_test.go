@@ -0,0 +1,82 @@
+package stego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBitWriterReader tests that bytes survive a round trip most significant bit first
+func TestBitWriterReader(t *testing.T) {
+	t.Parallel()
+
+	bits := make([]byte, 20)
+	w := &bitWriter{set: func(i int, bit byte) { bits[i] = bit }, capacity: len(bits)}
+
+	n, err := w.Write([]byte{0xA5})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []byte{1, 0, 1, 0, 0, 1, 0, 1}, bits[:8])
+
+	// Only one more whole byte fits into the remaining 12 bits
+	_, err = w.Write([]byte{0x0F, 0xF0})
+	assert.ErrorIs(t, err, errBitCapacity)
+	_, err = w.Write([]byte{0x3C})
+	require.NoError(t, err)
+
+	r := &bitReader{get: func(i int) byte { return bits[i] }, capacity: len(bits)}
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xA5, 0x3C}, data)
+}
+
+// TestRandomBits tests that every requested bit is set exactly once
+func TestRandomBits(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int{0, 1, 13, streamChunk*8 + 5} {
+		calls := make([]byte, n)
+		require.NoError(t, randomBits(n, func(i int, bit byte) {
+			assert.LessOrEqual(t, bit, byte(1))
+			calls[i]++
+		}))
+		assert.Equal(t, bytes.Repeat([]byte{1}, n), calls, "%d bits", n)
+	}
+}
+
+// TestExtractHostileLength tests that a forged length prefix is rejected without a large allocation
+func TestExtractHostileLength(t *testing.T) {
+	cover := createTestImage(200, 200)
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+	s := NewFractalStego()
+
+	// Embed a valid payload, then overwrite its length prefix with a huge value
+	img, err := s.Embed(cover, []byte("payload"), config)
+	require.NoError(t, err)
+	rgba := img.(*image.RGBA)
+	order, err := s.embeddingOrder(t.Context(), 200, 200, &FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}, nil)
+	require.NoError(t, err)
+
+	var prefix bytes.Buffer
+	require.NoError(t, binary.Write(&prefix, binary.BigEndian, uint32(0xFFFFFFF0)))
+	w := &bitWriter{set: func(i int, bit byte) {
+		offset := rgba.PixOffset(order[i]%200, order[i]/200) + 2
+		rgba.Pix[offset] = rgba.Pix[offset]&0xFE | bit
+	}, capacity: 32}
+	_, err = w.Write(prefix.Bytes())
+	require.NoError(t, err)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = s.Extract(rgba, config)
+	runtime.ReadMemStats(&after)
+
+	assert.ErrorContains(t, err, "invalid data length")
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
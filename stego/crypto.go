@@ -0,0 +1,289 @@
+package stego
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// encryptedMagic marks payloads wrapped into an encryption envelope
+const encryptedMagic = "STGENC1\x00"
+
+// Encryption modes stored after the envelope magic
+const (
+	encModePassword   byte = 1
+	encModeRecipients byte = 2
+)
+
+const (
+	fileKeySize  = 32
+	saltSize     = 16
+	wrappedSize  = fileKeySize + 16
+	x25519Size   = 32
+	recipientTag = "kursovaya recipient v1"
+)
+
+// PasswordIterations is the PBKDF2-SHA256 work factor used for new password envelopes
+var PasswordIterations = 600000
+
+// maxPasswordIterations bounds the work factor accepted from an untrusted envelope
+const maxPasswordIterations = 10000000
+
+// ErrNoDecryptionKey is returned when an encrypted payload is opened without a password or private key
+var ErrNoDecryptionKey = errors.New("payload is encrypted, a password or private key is required")
+
+// IsEncrypted reports whether the payload is wrapped into an encryption envelope
+func IsEncrypted(data []byte) bool {
+	return len(data) > len(encryptedMagic) && string(data[:len(encryptedMagic)]) == encryptedMagic
+}
+
+// EncryptWithPassword encrypts data with AES-256-GCM under a key derived from password.
+//
+// The envelope is magic, mode, salt, uint32(iterations), nonce and ciphertext.
+func EncryptWithPassword(data []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("password must not be empty")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, PasswordIterations, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte(encryptedMagic)
+	out = append(out, encModePassword)
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, uint32(PasswordIterations))
+	return sealData(out, key, data)
+}
+
+// EncryptForRecipients encrypts data so that any holder of a matching X25519 private key can read it.
+// A random file key encrypts the data and is wrapped for every recipient using an ephemeral key.
+//
+// The envelope is magic, mode, ephemeral public key, uint8(count), the wrapped
+// file keys, nonce and ciphertext.
+func EncryptForRecipients(data []byte, recipients []*ecdh.PublicKey) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	if len(recipients) > 255 {
+		return nil, fmt.Errorf("too many recipients: %d", len(recipients))
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	out := []byte(encryptedMagic)
+	out = append(out, encModeRecipients)
+	out = append(out, ephemeral.PublicKey().Bytes()...)
+	out = append(out, byte(len(recipients)))
+
+	for _, recipient := range recipients {
+		if recipient.Curve() != ecdh.X25519() {
+			return nil, errors.New("recipient key is not an X25519 key")
+		}
+		shared, err := ephemeral.ECDH(recipient)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := wrapAEAD(shared, ephemeral.PublicKey(), recipient)
+		if err != nil {
+			return nil, err
+		}
+		// every wrapping key is unique, so a zero nonce is safe
+		out = aead.Seal(out, make([]byte, aead.NonceSize()), fileKey, nil)
+	}
+
+	return sealData(out, fileKey, data)
+}
+
+// EncryptOptions selects how a payload is encrypted before embedding
+type EncryptOptions struct {
+	// Password enables password-based encryption
+	Password string
+	// Recipients enables encryption to the X25519 public keys
+	Recipients []*ecdh.PublicKey
+}
+
+// DecryptOptions holds the secrets available for opening an encrypted payload
+type DecryptOptions struct {
+	// Password is tried on password envelopes
+	Password string
+	// Identities are the X25519 private keys tried on recipient envelopes
+	Identities []*ecdh.PrivateKey
+}
+
+// Encrypt wraps data into an envelope according to opts.
+// Without a password or recipients the data is returned unchanged.
+func Encrypt(data []byte, opts EncryptOptions) ([]byte, error) {
+	switch {
+	case opts.Password != "" && len(opts.Recipients) > 0:
+		return nil, errors.New("choose either a password or recipients, not both")
+	case opts.Password != "":
+		return EncryptWithPassword(data, opts.Password)
+	case len(opts.Recipients) > 0:
+		return EncryptForRecipients(data, opts.Recipients)
+	default:
+		return data, nil
+	}
+}
+
+// Decrypt opens an encryption envelope with the password or one of the private keys.
+// Data without an envelope is returned unchanged.
+func Decrypt(data []byte, opts DecryptOptions) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	password, identities := opts.Password, opts.Identities
+	rest := data[len(encryptedMagic):]
+	mode, rest := rest[0], rest[1:]
+
+	switch mode {
+	case encModePassword:
+		if password == "" {
+			return nil, ErrNoDecryptionKey
+		}
+		if len(rest) < saltSize+4 {
+			return nil, errors.New("corrupted encryption envelope")
+		}
+		salt := rest[:saltSize]
+		iterations := binary.BigEndian.Uint32(rest[saltSize:])
+		if iterations == 0 || iterations > maxPasswordIterations {
+			return nil, errors.New("corrupted encryption envelope")
+		}
+		key, err := pbkdf2.Key(sha256.New, password, salt, int(iterations), fileKeySize)
+		if err != nil {
+			return nil, err
+		}
+		plain, err := openData(key, rest[saltSize+4:])
+		if err != nil {
+			return nil, errors.New("wrong password or corrupted payload")
+		}
+		return plain, nil
+
+	case encModeRecipients:
+		if len(identities) == 0 {
+			return nil, ErrNoDecryptionKey
+		}
+		if len(rest) < x25519Size+1 {
+			return nil, errors.New("corrupted encryption envelope")
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(rest[:x25519Size])
+		if err != nil {
+			return nil, err
+		}
+		count := int(rest[x25519Size])
+		rest = rest[x25519Size+1:]
+		if len(rest) < count*wrappedSize {
+			return nil, errors.New("corrupted encryption envelope")
+		}
+		stanzas, body := rest[:count*wrappedSize], rest[count*wrappedSize:]
+
+		for _, identity := range identities {
+			fileKey := unwrapFileKey(identity, ephemeral, stanzas, count)
+			if fileKey == nil {
+				continue
+			}
+			plain, err := openData(fileKey, body)
+			if err != nil {
+				return nil, errors.New("corrupted encrypted payload")
+			}
+			return plain, nil
+		}
+		return nil, errors.New("payload is not encrypted for any of the supplied private keys")
+
+	default:
+		return nil, fmt.Errorf("unknown encryption mode: %d", mode)
+	}
+}
+
+// unwrapFileKey tries the identity against every wrapped file key and returns the first one it opens
+func unwrapFileKey(identity *ecdh.PrivateKey, ephemeral *ecdh.PublicKey, stanzas []byte, count int) []byte {
+	if identity.Curve() != ecdh.X25519() {
+		return nil
+	}
+	shared, err := identity.ECDH(ephemeral)
+	if err != nil {
+		return nil
+	}
+	aead, err := wrapAEAD(shared, ephemeral, identity.PublicKey())
+	if err != nil {
+		return nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	for i := 0; i < count; i++ {
+		fileKey, err := aead.Open(nil, nonce, stanzas[i*wrappedSize:(i+1)*wrappedSize], nil)
+		if err == nil {
+			return fileKey
+		}
+	}
+	return nil
+}
+
+// wrapAEAD derives the cipher that wraps the file key for one recipient
+func wrapAEAD(shared []byte, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	key, err := hkdf.Key(sha256.New, shared, salt, recipientTag, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// sealData appends a random nonce and the AES-GCM ciphertext of data to out
+func sealData(out, key, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, nil), nil
+}
+
+// openData reverses sealData
+func openData(key, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
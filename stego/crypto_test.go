@@ -0,0 +1,89 @@
+package stego
+
+import (
+	"crypto/ecdh"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPasswordEncryption tests the password envelope round trip
+func TestPasswordEncryption(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("password protected payload")
+
+	sealed, err := EncryptWithPassword(data, "correct horse")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(sealed))
+
+	plain, err := Decrypt(sealed, DecryptOptions{Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, data, plain)
+
+	_, err = Decrypt(sealed, DecryptOptions{Password: "wrong"})
+	assert.Error(t, err)
+
+	_, err = Decrypt(sealed, DecryptOptions{})
+	assert.ErrorIs(t, err, ErrNoDecryptionKey)
+
+	_, err = Encrypt(data, EncryptOptions{Password: "x", Recipients: []*ecdh.PublicKey{nil}})
+	assert.Error(t, err)
+
+	unchanged, err := Decrypt(data, DecryptOptions{Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, data, unchanged)
+}
+
+// TestRecipientEncryption tests that every recipient, and only they, can decrypt the payload
+func TestRecipientEncryption(t *testing.T) {
+	t.Parallel()
+
+	alice, err := GenerateRecipientKey()
+	require.NoError(t, err)
+	bob, err := GenerateRecipientKey()
+	require.NoError(t, err)
+	eve, err := GenerateRecipientKey()
+	require.NoError(t, err)
+
+	data := []byte("for alice and bob")
+	sealed, err := EncryptForRecipients(data, []*ecdh.PublicKey{alice.PublicKey(), bob.PublicKey()})
+	require.NoError(t, err)
+
+	for _, identity := range []*ecdh.PrivateKey{alice, bob} {
+		plain, err := Decrypt(sealed, DecryptOptions{Identities: []*ecdh.PrivateKey{eve, identity}})
+		require.NoError(t, err)
+		assert.Equal(t, data, plain)
+	}
+
+	_, err = Decrypt(sealed, DecryptOptions{Identities: []*ecdh.PrivateKey{eve}})
+	assert.Error(t, err)
+}
+
+// TestKeyEncoding tests that keys survive PEM and raw encodings
+func TestKeyEncoding(t *testing.T) {
+	t.Parallel()
+
+	key, err := GenerateRecipientKey()
+	require.NoError(t, err)
+
+	privPEM, err := MarshalPrivateKey(key)
+	require.NoError(t, err)
+	parsedPriv, err := ParseIdentity(privPEM)
+	require.NoError(t, err)
+	assert.True(t, key.Equal(parsedPriv))
+
+	pubPEM, err := MarshalPublicKey(key.PublicKey())
+	require.NoError(t, err)
+	parsedPub, err := ParseRecipientKey(pubPEM)
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey().Equal(parsedPub))
+
+	rawPub, err := ParseRecipientKey(key.PublicKey().Bytes())
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey().Equal(rawPub))
+
+	_, err = ParseIdentity(pubPEM)
+	assert.Error(t, err)
+}
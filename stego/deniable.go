@@ -0,0 +1,342 @@
+package stego
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	mrand "math/rand/v2"
+)
+
+// deniableIterations is the PBKDF2-SHA256 work factor for deniable slot keys.
+// It is fixed because nothing but the salt is stored in the clear.
+const deniableIterations = 600000
+
+// deniableOverhead is the per-slot cost: salt, nonce, GCM tag and the length prefix
+const deniableOverhead = saltSize + 12 + 16 + 4
+
+// ErrNoDeniablePayload is returned when the key unlocks none of the slots
+var ErrNoDeniablePayload = errors.New("no payload can be unlocked with this key")
+
+// EmbedDeniable hides a decoy payload and, optionally, a hidden payload under two different keys.
+// The fractal-eligible pixels are split into two disjoint slots by a permutation keyed with a
+// random salt of the image; each payload is encrypted to fill its slot completely and scattered
+// inside it by a keyed permutation. Without a hidden payload the second slot is filled with
+// random bits, so its presence cannot be told without the second key.
+func (f *FractalStego) EmbedDeniable(cover image.Image, decoy []byte, decoyKey string, hidden []byte, hiddenKey string, config Config) (image.Image, error) {
+	params, err := fractalParams(config)
+	if err != nil {
+		return nil, err
+	}
+	if decoyKey == "" {
+		return nil, errors.New("decoy key must not be empty")
+	}
+	if hidden != nil && hiddenKey == "" {
+		return nil, errors.New("hidden key must not be empty")
+	}
+	if hidden != nil && hiddenKey == decoyKey {
+		return nil, errors.New("decoy and hidden keys must differ")
+	}
+
+	area, err := embeddingArea(cover.Bounds(), config.Region)
+	if err != nil {
+		return nil, err
+	}
+	order, err := f.carrierOrder(context.Background(), cover, area, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) < partitionSaltBits {
+		return nil, errors.New("image too small to embed data")
+	}
+
+	// A fresh partition salt for every image, so the slots never follow a fixed pattern
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	slots, err := partitionSlots(order[partitionSaltBits:], salt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Randomly choose which slot carries the decoy
+	var coin [1]byte
+	if _, err := rand.Read(coin[:]); err != nil {
+		return nil, err
+	}
+	decoySlot := int(coin[0] & 1)
+
+	stego, plane := cloneCover(cover)
+
+	width := area.Dx()
+	saltWriter := &bitWriter{
+		set: func(j int, bit byte) {
+			pixel := order[j]
+			plane.setBit(area.Min.X+pixel%width, area.Min.Y+pixel/width, bit)
+		},
+		capacity: partitionSaltBits,
+	}
+	if _, err := saltWriter.Write(salt); err != nil {
+		return nil, err
+	}
+
+	payloads := [2][]byte{}
+	keys := [2]string{}
+	payloads[decoySlot], keys[decoySlot] = decoy, decoyKey
+	payloads[1-decoySlot], keys[1-decoySlot] = hidden, hiddenKey
+
+	for i, slot := range slots {
+		// set stores bit number j of the slot in its pixel
+		set := func(j int, bit byte) {
+			pixel := slot[j]
+			plane.setBit(area.Min.X+pixel%width, area.Min.Y+pixel/width, bit)
+		}
+
+		var err error
+		if keys[i] == "" {
+			err = randomBits(len(slot), set)
+		} else {
+			err = sealSlot(payloads[i], keys[i], len(slot), set)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stego, nil
+}
+
+// ExtractDeniable returns whichever payload the key unlocks
+func (f *FractalStego) ExtractDeniable(stego image.Image, key string, config Config) ([]byte, error) {
+	params, err := fractalParams(config)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errors.New("key must not be empty")
+	}
+
+	area, err := embeddingArea(stego.Bounds(), config.Region)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := f.deniableSlots(stego, area, params)
+	if err != nil {
+		return nil, err
+	}
+	lsb := lsbReader(stego)
+	width := area.Dx()
+	for _, slot := range slots {
+		// get reads bit number j of the slot from its pixel
+		get := func(j int) byte {
+			pixel := slot[j]
+			return lsb(area.Min.X+pixel%width, area.Min.Y+pixel/width)
+		}
+
+		if data, err := openSlot(get, len(slot), key); err == nil {
+			return data, nil
+		}
+	}
+
+	return nil, ErrNoDeniablePayload
+}
+
+// DeniableCapacity returns how many bytes each of the two payloads may hold
+func (f *FractalStego) DeniableCapacity(cover image.Image, config Config) (int, error) {
+	params, err := fractalParams(config)
+	if err != nil {
+		return 0, err
+	}
+
+	area, err := embeddingArea(cover.Bounds(), config.Region)
+	if err != nil {
+		return 0, err
+	}
+	order, err := f.carrierOrder(context.Background(), cover, area, params, nil)
+	if err != nil {
+		return 0, err
+	}
+	// The smaller slot gets half of the pixels left after the partition salt
+	return max((len(order)-partitionSaltBits)/2/8-deniableOverhead, 0), nil
+}
+
+// partitionSaltBits is the number of eligible pixels, first in carrier order, holding the partition salt
+const partitionSaltBits = saltSize * 8
+
+// deniableSlots reads the partition salt from the eligible pixels of the area of img and
+// returns the two slots it selects
+func (f *FractalStego) deniableSlots(img image.Image, area image.Rectangle, params *FractalParams) ([2][]int, error) {
+	order, err := f.carrierOrder(context.Background(), img, area, params, nil)
+	if err != nil {
+		return [2][]int{}, err
+	}
+	if len(order) < partitionSaltBits {
+		return [2][]int{}, ErrNoDeniablePayload
+	}
+
+	lsb := lsbReader(img)
+	width := area.Dx()
+	salt := make([]byte, saltSize)
+	saltReader := &bitReader{
+		get: func(j int) byte {
+			pixel := order[j]
+			return lsb(area.Min.X+pixel%width, area.Min.Y+pixel/width)
+		},
+		capacity: partitionSaltBits,
+	}
+	if _, err := io.ReadFull(saltReader, salt); err != nil {
+		return [2][]int{}, err
+	}
+	return partitionSlots(order[partitionSaltBits:], salt)
+}
+
+// partitionSlots splits the pixels into two disjoint slots of equal size, alternating them in
+// the order of a permutation seeded from the salt, so that which slot a pixel belongs to
+// changes from image to image instead of following its position
+func partitionSlots(pixels []int, salt []byte) ([2][]int, error) {
+	var slots [2][]int
+
+	key, err := hkdf.Key(sha256.New, salt, nil, "kursovaya deniable partition", 32)
+	if err != nil {
+		return slots, err
+	}
+	var seed [32]byte
+	copy(seed[:], key)
+
+	for i, j := range slotPermutation(len(pixels), seed) {
+		slots[i%2] = append(slots[i%2], pixels[j])
+	}
+	return slots, nil
+}
+
+// sealSlot encrypts data under key into exactly one bit per slot pixel, passing each bit to set.
+// The salt occupies the first pixels in scan order; the rest is permuted by the derived key.
+func sealSlot(data []byte, key string, slotBits int, set func(j int, bit byte)) error {
+	slotBytes := slotBits / 8
+	capacity := slotBytes - deniableOverhead
+	if len(data) > capacity {
+		return fmt.Errorf("image too small to embed data: payload is %d bytes, capacity is %d bytes",
+			len(data), max(capacity, 0))
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	encKey, permSeed, err := deriveSlotKeys(key, salt)
+	if err != nil {
+		return err
+	}
+
+	// length prefix, data and zero padding up to the slot size
+	plain := make([]byte, capacity+4)
+	binary.BigEndian.PutUint32(plain, uint32(len(data)))
+	copy(plain[4:], data)
+
+	sealed, err := sealData(nil, encKey, plain)
+	if err != nil {
+		return err
+	}
+
+	saltBits := len(salt) * 8
+	if _, err := (&bitWriter{set: set, capacity: saltBits}).Write(salt); err != nil {
+		return err
+	}
+
+	order := slotPermutation(slotBits-saltBits, permSeed)
+	body := &bitWriter{
+		set:      func(j int, bit byte) { set(saltBits+order[j], bit) },
+		capacity: len(order),
+	}
+	if _, err := body.Write(sealed); err != nil {
+		return err
+	}
+
+	// pixels left over by the byte rounding carry random bits
+	rest := order[len(sealed)*8:]
+	return randomBits(len(rest), func(j int, bit byte) {
+		set(saltBits+rest[j], bit)
+	})
+}
+
+// openSlot reverses sealSlot, taking the bits of the slot from get
+func openSlot(get func(j int) byte, slotBits int, key string) ([]byte, error) {
+	slotBytes := slotBits / 8
+	capacity := slotBytes - deniableOverhead
+	if capacity < 0 {
+		return nil, ErrNoDeniablePayload
+	}
+
+	saltBits := saltSize * 8
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(&bitReader{get: get, capacity: saltBits}, salt); err != nil {
+		return nil, err
+	}
+	encKey, permSeed, err := deriveSlotKeys(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	order := slotPermutation(slotBits-saltBits, permSeed)
+	sealed := make([]byte, slotBytes-saltSize)
+	body := &bitReader{
+		get:      func(j int) byte { return get(saltBits + order[j]) },
+		capacity: len(order),
+	}
+	if _, err := io.ReadFull(body, sealed); err != nil {
+		return nil, err
+	}
+
+	plain, err := openData(encKey, sealed)
+	if err != nil {
+		return nil, ErrNoDeniablePayload
+	}
+
+	length := binary.BigEndian.Uint32(plain)
+	if uint64(length) > uint64(len(plain)-4) {
+		return nil, ErrNoDeniablePayload
+	}
+
+	return plain[4 : 4+length], nil
+}
+
+// deriveSlotKeys stretches the key into the AES key and the permutation seed of a slot
+func deriveSlotKeys(key string, salt []byte) ([]byte, [32]byte, error) {
+	var seed [32]byte
+
+	master, err := pbkdf2.Key(sha256.New, key, salt, deniableIterations, fileKeySize)
+	if err != nil {
+		return nil, seed, err
+	}
+	encKey, err := hkdf.Key(sha256.New, master, nil, "kursovaya deniable encryption", fileKeySize)
+	if err != nil {
+		return nil, seed, err
+	}
+	permKey, err := hkdf.Key(sha256.New, master, nil, "kursovaya deniable permutation", len(seed))
+	if err != nil {
+		return nil, seed, err
+	}
+	copy(seed[:], permKey)
+
+	return encKey, seed, nil
+}
+
+// slotPermutation returns a keyed permutation of 0..n-1
+func slotPermutation(n int, seed [32]byte) []int {
+	rng := mrand.New(mrand.NewChaCha8(seed))
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	rng.Shuffle(n, func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	return order
+}
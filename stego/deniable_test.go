@@ -0,0 +1,98 @@
+package stego
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeniableEmbedExtract tests that each key unlocks only its own payload
+func TestDeniableEmbedExtract(t *testing.T) {
+	t.Parallel()
+
+	var stego DeniableSteganographer = NewFractalStego()
+	config := splitTestConfig()
+	cover := createTestImage(200, 200)
+
+	decoy := []byte("shopping list: milk, bread")
+	hidden := []byte("the real message")
+
+	stegoImg, err := stego.EmbedDeniable(cover, decoy, "decoy key", hidden, "hidden key", config)
+	require.NoError(t, err)
+
+	got, err := stego.ExtractDeniable(stegoImg, "decoy key", config)
+	require.NoError(t, err)
+	assert.Equal(t, decoy, got)
+
+	got, err = stego.ExtractDeniable(stegoImg, "hidden key", config)
+	require.NoError(t, err)
+	assert.Equal(t, hidden, got)
+
+	_, err = stego.ExtractDeniable(stegoImg, "wrong key", config)
+	assert.ErrorIs(t, err, ErrNoDeniablePayload)
+}
+
+// TestDeniableDecoyOnly tests embedding without a hidden payload
+func TestDeniableDecoyOnly(t *testing.T) {
+	t.Parallel()
+
+	stego := NewFractalStego()
+	config := splitTestConfig()
+	cover := createTestImage(150, 150)
+
+	stegoImg, err := stego.EmbedDeniable(cover, []byte("decoy"), "decoy key", nil, "", config)
+	require.NoError(t, err)
+
+	got, err := stego.ExtractDeniable(stegoImg, "decoy key", config)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("decoy"), got)
+
+	_, err = stego.EmbedDeniable(cover, []byte("a"), "same", []byte("b"), "same", config)
+	assert.Error(t, err)
+
+	capacity, err := stego.DeniableCapacity(cover, config)
+	require.NoError(t, err)
+	_, err = stego.EmbedDeniable(cover, make([]byte, capacity+1), "decoy key", nil, "", config)
+	assert.Error(t, err)
+}
+
+// TestDeniableSlotsKeyed tests that the slots depend on the partition salt of each image
+// rather than on the position of the pixels
+func TestDeniableSlotsKeyed(t *testing.T) {
+	t.Parallel()
+
+	f := NewFractalStego()
+	config := splitTestConfig()
+	cover := createTestImage(150, 150)
+	params, err := fractalParams(config)
+	require.NoError(t, err)
+	area := cover.Bounds()
+
+	var slots [2][2][]int
+	for i := range slots {
+		stegoImg, err := f.EmbedDeniable(cover, []byte("decoy"), "decoy key", nil, "", config)
+		require.NoError(t, err)
+		slots[i], err = f.deniableSlots(stegoImg, area, params)
+		require.NoError(t, err)
+	}
+	assert.NotEqual(t, slots[0][0], slots[1][0])
+
+	// Neither slot is made of every other eligible pixel
+	order, err := f.carrierOrder(context.Background(), cover, area, params, nil)
+	require.NoError(t, err)
+	rest := order[partitionSaltBits:]
+	position := make(map[int]int, len(rest))
+	for i, pixel := range rest {
+		position[pixel] = i
+	}
+	for _, slot := range slots[0] {
+		var parity [2]int
+		for _, pixel := range slot {
+			parity[position[pixel]%2]++
+		}
+		assert.NotZero(t, parity[0])
+		assert.NotZero(t, parity[1])
+	}
+}
@@ -0,0 +1,80 @@
+package stego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"slices"
+)
+
+// ErrNotDetected is returned when no algorithm and parameter combination yields a valid payload
+var ErrNotDetected = errors.New("no payload found with any known algorithm and parameters")
+
+// Detection describes the algorithm and parameters an embedded payload was found with
+type Detection struct {
+	// Algorithm is the ID the algorithm is registered under
+	Algorithm string
+	// Config holds the parameters that extract the payload
+	Config Config
+	// Header is the payload header that validated the guess
+	Header PayloadHeader
+}
+
+func (d *Detection) String() string {
+	s := "algorithm " + d.Algorithm
+	info, _ := Lookup(d.Algorithm)
+	if params := info.Schema.Public(d.Config.Params); len(params) > 0 {
+		s += ", " + params.Summary()
+	}
+	if d.Header.Total > 1 {
+		s += fmt.Sprintf(", piece %d of %d", d.Header.Seq+1, d.Header.Total)
+	}
+	return s + fmt.Sprintf(", %d bytes", d.Header.Length)
+}
+
+// Detect tries every registered algorithm with the stored parameters and then with its
+// Candidates, and returns the first combination whose extracted data carries a payload
+// header with a valid checksum. Stored parameters that an algorithm does not accept are
+// skipped for it. Images embedded without a payload header cannot be detected.
+func Detect(img image.Image, stored []Params) (*Detection, error) {
+	return DetectContext(context.Background(), img, stored, nil)
+}
+
+// DetectContext is Detect with cancellation and progress reports, each tried combination
+// taking an equal share of the progress
+func DetectContext(ctx context.Context, img image.Image, stored []Params, progress Progress) (*Detection, error) {
+	type attempt struct {
+		info   AlgorithmInfo
+		config Config
+	}
+	var attempts []attempt
+	for _, info := range Registered() {
+		seen := make(map[string]bool)
+		for _, params := range append(slices.Clip(stored), info.Candidates...) {
+			resolved, err := info.Schema.Resolve(params)
+			if err != nil || seen[resolved.Summary()] {
+				continue
+			}
+			seen[resolved.Summary()] = true
+			attempts = append(attempts, attempt{info: info, config: Config{Params: resolved}})
+		}
+	}
+
+	for i, a := range attempts {
+		data, err := ExtractContext(ctx, a.info.New(), img, a.config, frameProgress(progress, i, len(attempts)))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			continue
+		}
+		header, _, err := DecodePayload(data)
+		if err != nil {
+			continue
+		}
+		return &Detection{Algorithm: a.info.ID, Config: a.config, Header: header}, nil
+	}
+
+	return nil, ErrNotDetected
+}
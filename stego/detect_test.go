@@ -0,0 +1,78 @@
+package stego
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDetect tests that the parameters of an embedded payload are found without being given
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	fractal := NewFractalStego()
+	cover := createTestImage(120, 120)
+	data := []byte("detect me")
+
+	sealed, err := SealPayload(data)
+	require.NoError(t, err)
+
+	// Parameters from the candidate list
+	config := Config{Params: FractalParams{Type: "Mandelbrot", Iterations: 200, Threshold: 4}.Params()}
+	stegoImage, err := fractal.Embed(cover, sealed, config)
+	require.NoError(t, err)
+
+	detection, err := Detect(stegoImage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "fractal", detection.Algorithm)
+	assert.Equal(t, uint32(len(data)), detection.Header.Length)
+
+	extracted, err := fractal.Extract(stegoImage, detection.Config)
+	require.NoError(t, err)
+	opened, err := OpenPayload(extracted)
+	require.NoError(t, err)
+	assert.Equal(t, data, opened)
+
+	// Parameters only known from storage
+	stored := FractalParams{Type: "Mandelbrot", Iterations: 77, Threshold: 3}.Params()
+	stegoImage, err = fractal.Embed(cover, sealed, Config{Params: stored})
+	require.NoError(t, err)
+
+	detection, err = Detect(stegoImage, []Params{stored})
+	require.NoError(t, err)
+	assert.Equal(t, stored, detection.Config.Params)
+}
+
+// TestDetectNothing tests that a clean image is reported as undetected
+func TestDetectNothing(t *testing.T) {
+	t.Parallel()
+
+	_, err := Detect(createTestImage(60, 60), nil)
+	assert.ErrorIs(t, err, ErrNotDetected)
+}
+
+func TestDetectKeepsStored(t *testing.T) {
+	t.Parallel()
+
+	// Spare capacity must not be overwritten by the candidates
+	stored := make([]Params, 1, 8)
+	stored[0] = FractalParams{Type: "Julia", Iterations: 50, Threshold: 2}.Params()
+	spare := stored[:cap(stored)]
+	_, err := Detect(createTestImage(60, 60), stored)
+	assert.ErrorIs(t, err, ErrNotDetected)
+	for _, params := range spare[1:] {
+		assert.Nil(t, params)
+	}
+}
+
+func TestDetectCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := DetectFrames(ctx, []image.Image{createTestImage(60, 60)}, image.Rectangle{}, nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,14 +2,126 @@ package stego
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 )
 
-// Factory creates and returns the appropriate steganography algorithm
+// DefaultLanguage is the language used when a display text is missing for the requested one
+const DefaultLanguage = "en"
+
+// AlgorithmInfo describes a steganography algorithm in the registry
+type AlgorithmInfo struct {
+	// ID is the stable ASCII identifier used in profiles and on the command line
+	ID string
+	// Names holds the display names keyed by language, e.g. "en" and "ru"
+	Names map[string]string
+	// Descriptions holds a one-sentence description keyed by language
+	Descriptions map[string]string
+	// Schema describes the parameters the algorithm reads from Config.Params
+	Schema Schema
+	// Candidates lists the parameter sets Detect tries, most common first
+	Candidates []Params
+	// New creates an instance of the algorithm
+	New func() Steganographer
+	// KeepsPalette reports that stego images of paletted covers stay paletted, so they can
+	// be saved as GIF; other algorithms turn paletted covers into true color images
+	KeepsPalette bool
+}
+
+// DisplayName returns the name of the algorithm in the given language
+func (i AlgorithmInfo) DisplayName(lang string) string {
+	return localized(i.Names, lang, i.ID)
+}
+
+// Description returns the description of the algorithm in the given language
+func (i AlgorithmInfo) Description(lang string) string {
+	return localized(i.Descriptions, lang, "")
+}
+
+// localized picks the text for lang, falling back to DefaultLanguage and then to fallback
+func localized(texts map[string]string, lang, fallback string) string {
+	if text, ok := texts[lang]; ok {
+		return text
+	}
+	if text, ok := texts[DefaultLanguage]; ok {
+		return text
+	}
+	return fallback
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]AlgorithmInfo)
+)
+
+// Register makes an algorithm available to Factory and to everything enumerating Registered.
+// It is meant to be called from the init function of the file implementing the algorithm
+// and panics if the ID is empty, not printable ASCII or already registered.
+func Register(info AlgorithmInfo) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if info.ID == "" || info.New == nil {
+		panic("stego: Register requires an ID and a constructor")
+	}
+	for _, r := range info.ID {
+		if r <= ' ' || r > '~' {
+			panic(fmt.Sprintf("stego: algorithm ID %q is not printable ASCII", info.ID))
+		}
+	}
+	if _, dup := registry[info.ID]; dup {
+		panic(fmt.Sprintf("stego: Register called twice for algorithm %s", info.ID))
+	}
+
+	registry[info.ID] = info
+}
+
+// Registered returns all registered algorithms sorted by ID
+func Registered() []AlgorithmInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	infos := make([]AlgorithmInfo, 0, len(registry))
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Lookup finds a registered algorithm by its ID or by any of its display names
+func Lookup(name string) (AlgorithmInfo, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if info, ok := registry[name]; ok {
+		return info, true
+	}
+	for _, info := range registry {
+		for _, displayName := range info.Names {
+			if displayName == name {
+				return info, true
+			}
+		}
+	}
+	return AlgorithmInfo{}, false
+}
+
+// Algorithms returns the IDs of all registered algorithms
+func Algorithms() []string {
+	infos := Registered()
+	ids := make([]string, len(infos))
+	for i, info := range infos {
+		ids[i] = info.ID
+	}
+	return ids
+}
+
+// Factory creates the algorithm registered under the given ID or display name
 func Factory(algorithmName string) (Steganographer, error) {
-	switch algorithmName {
-	case "Фрактал":
-		return NewFractalStego(), nil
-	default:
+	info, ok := Lookup(algorithmName)
+	if !ok {
 		return nil, fmt.Errorf("unknown steganography algorithm: %s", algorithmName)
 	}
+	return info.New(), nil
 }
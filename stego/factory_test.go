@@ -0,0 +1,42 @@
+package stego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistry tests that the built-in algorithms are registered and found by ID and display name
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	info, ok := Lookup("fractal")
+	require.True(t, ok)
+	assert.Equal(t, "Fractal", info.DisplayName("en"))
+	assert.Equal(t, "Фрактал", info.DisplayName("ru"))
+	assert.Equal(t, "Fractal", info.DisplayName("de"))
+	assert.NotEmpty(t, info.Description("ru"))
+	assert.Contains(t, Algorithms(), "fractal")
+
+	for _, name := range []string{"fractal", "Фрактал", "Fractal"} {
+		algorithm, err := Factory(name)
+		require.NoError(t, err)
+		assert.IsType(t, &FractalStego{}, algorithm)
+	}
+
+	// Names of the algorithms are the IDs, so that errors stay in the language of the caller
+	for _, info := range Registered() {
+		assert.Equal(t, info.ID, info.New().Name())
+	}
+
+	_, err := Factory("missing")
+	assert.Error(t, err)
+
+	assert.Panics(t, func() {
+		Register(AlgorithmInfo{ID: "fractal", New: info.New})
+	})
+	assert.Panics(t, func() {
+		Register(AlgorithmInfo{ID: "фрактал", New: info.New})
+	})
+}
@@ -1,14 +1,125 @@
 package stego
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"image"
-	"image/color"
-	"image/draw"
+	"io"
 	"math/cmplx"
 )
 
+func init() {
+	Register(AlgorithmInfo{
+		ID: "fractal",
+		Names: map[string]string{
+			"en": "Fractal",
+			"ru": "Фрактал",
+		},
+		Descriptions: map[string]string{
+			"en": "Hides data in the blue channel LSB of pixels inside a Mandelbrot or Julia set, optionally derived from a passphrase",
+			"ru": "Скрывает данные в младшем бите синего канала пикселей внутри множества Мандельброта или Жулиа, которое может задаваться парольной фразой",
+		},
+		Schema:     fractalSchema,
+		Candidates: fractalCandidates(),
+		New: func() Steganographer {
+			return NewFractalStego()
+		},
+	})
+}
+
+// fractalSchema describes the parameters of the fractal algorithm
+var fractalSchema = Schema{
+	{
+		Name:   "type",
+		Kind:   ParamEnum,
+		Labels: map[string]string{"en": "Fractal type", "ru": "Тип фрактала"},
+		Help: map[string]string{
+			"en": "Set whose interior pixels carry the data",
+			"ru": "Множество, во внутренних пикселях которого хранятся данные",
+		},
+		Default: "Mandelbrot",
+		Choices: []Choice{
+			{Value: "Mandelbrot", Labels: map[string]string{"en": "Mandelbrot", "ru": "Мандельброт"}},
+			{Value: "Julia", Labels: map[string]string{"en": "Julia", "ru": "Жулиа"}},
+		},
+	},
+	{
+		Name:   "iterations",
+		Kind:   ParamInt,
+		Labels: map[string]string{"en": "Iterations", "ru": "Итерация"},
+		Help: map[string]string{
+			"en": "Maximum number of iterations of the escape test",
+			"ru": "Максимальное число итераций проверки выхода",
+		},
+		Min:     1,
+		Max:     100000,
+		Default: 100,
+	},
+	{
+		Name:   "threshold",
+		Kind:   ParamFloat,
+		Labels: map[string]string{"en": "Threshold", "ru": "Порог"},
+		Help: map[string]string{
+			"en": "Escape radius of the iteration",
+			"ru": "Радиус выхода итерации",
+		},
+		Min:     1,
+		Max:     1000,
+		Default: 2.0,
+	},
+	{
+		Name:   "passphrase",
+		Kind:   ParamString,
+		Labels: map[string]string{"en": "Passphrase", "ru": "Парольная фраза"},
+		Help: map[string]string{
+			"en": "Derives the fractal, its viewport and the pixel order in place of the other parameters",
+			"ru": "Задаёт фрактал, область просмотра и порядок пикселей вместо остальных параметров",
+		},
+		Default: "",
+		Secret:  true,
+	},
+}
+
+// fractalCandidates returns the parameter sets Detect tries, the GUI and CLI defaults first
+func fractalCandidates() []Params {
+	var candidates []Params
+	for _, fractalType := range []string{"Mandelbrot", "Julia"} {
+		for _, threshold := range []float64{2, 4, 10} {
+			for _, iterations := range []int{100, 50, 200, 20, 500, 1000, 10} {
+				candidates = append(candidates, FractalParams{
+					Type:       fractalType,
+					Iterations: iterations,
+					Threshold:  threshold,
+				}.Params())
+			}
+		}
+	}
+	return candidates
+}
+
+// fractalParams resolves the generic config parameters into fractal parameters
+func fractalParams(config Config) (*FractalParams, error) {
+	if len(config.Params) == 0 {
+		return nil, errors.New("fractal parameters are required")
+	}
+
+	params, err := fractalSchema.Resolve(config.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FractalParams{
+		Type:       params.String("type"),
+		Iterations: params.Int("iterations"),
+		Threshold:  params.Float("threshold"),
+		Passphrase: params.String("passphrase"),
+	}, nil
+}
+
 type FractalStego struct{}
 
 func NewFractalStego() *FractalStego {
@@ -16,103 +127,313 @@ func NewFractalStego() *FractalStego {
 }
 
 func (f *FractalStego) Name() string {
-	return "Фрактал"
+	return "fractal"
 }
 
+// patternShare is the part of the progress of an operation taken by computing the fractal pattern
+const patternShare = 0.9
+
+// streamChunk is the number of payload bytes read or written at a time
+const streamChunk = 32 << 10
+
 func (f *FractalStego) Embed(cover image.Image, data []byte, config Config) (image.Image, error) {
-	if config.FractalParams == nil {
-		return nil, errors.New("fractal parameters are required")
+	return f.EmbedContext(context.Background(), cover, data, config, nil)
+}
+
+// EmbedContext is Embed that can be cancelled through ctx and reports its progress
+func (f *FractalStego) EmbedContext(ctx context.Context, cover image.Image, data []byte, config Config, progress Progress) (image.Image, error) {
+	return f.embed(ctx, cover, bytes.NewReader(data), len(data), config, progress)
+}
+
+// EmbedStream embeds everything read from r, holding only one chunk of it at a time
+func (f *FractalStego) EmbedStream(cover image.Image, r io.Reader, config Config) (image.Image, error) {
+	return f.EmbedStreamContext(context.Background(), cover, r, config, nil)
+}
+
+// EmbedStreamContext is EmbedStream that can be cancelled through ctx and reports its progress
+func (f *FractalStego) EmbedStreamContext(ctx context.Context, cover image.Image, r io.Reader, config Config, progress Progress) (image.Image, error) {
+	return f.embed(ctx, cover, r, -1, config, progress)
+}
+
+// embed writes the data read from r into the pixels of the embedding order after a 32-bit
+// length prefix, which is filled in last. size is the length of the data if known, or -1.
+func (f *FractalStego) embed(ctx context.Context, cover image.Image, r io.Reader, size int, config Config, progress Progress) (image.Image, error) {
+	params, err := fractalParams(config)
+	if err != nil {
+		return nil, err
 	}
 
-	bounds := cover.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
+	area, err := embeddingArea(cover.Bounds(), config.Region)
+	if err != nil {
+		return nil, err
+	}
+	width := area.Dx()
 
-	requiredPixels := 32 + len(data)*8
-	if width*height < requiredPixels {
-		return nil, errors.New("image too small to embed data")
+	order, err := f.carrierOrder(ctx, cover, area, params,
+		newProgressStage(progress, 0, patternShare, area.Dy()))
+	if err != nil {
+		return nil, err
 	}
 
-	stego := image.NewRGBA(bounds)
-	draw.Draw(stego, bounds, cover, bounds.Min, draw.Src)
+	capacity := orderCapacity(order)
+	if size > capacity {
+		return nil, fmt.Errorf("image too small to embed data: payload is %d bytes, capacity is %d bytes",
+			size, capacity)
+	}
 
-	pattern := f.generateFractalPattern(width, height, config.FractalParams)
+	stego, plane := cloneCover(cover)
 
-	lengthBits := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthBits, uint32(len(data)))
-	allBits := append(bytesToBits(lengthBits), bytesToBits(data)...)
+	// set stores bit number i of the embedded data in the pixel at order[i]
+	set := func(i int, bit byte) {
+		pos := order[i]
+		plane.setBit(area.Min.X+pos%width, area.Min.Y+pos/width, bit)
+	}
+	prefix := &bitWriter{set: set, capacity: 32}
+	body := &bitWriter{set: func(i int, bit byte) { set(32+i, bit) }, capacity: capacity * 8}
 
-	bitPos := 0
-	for y := 0; y < height && bitPos < len(allBits); y++ {
-		for x := 0; x < width && bitPos < len(allBits); x++ {
-			if pattern[y*width+x] {
-				c := stego.RGBAAt(x, y)
-				c.B = (c.B & 0xFE) | allBits[bitPos]
-				stego.SetRGBA(x, y, c)
-				bitPos++
-			}
+	total := size
+	if total < 0 {
+		total = capacity
+	}
+	stage := newProgressStage(progress, patternShare, 1, total)
+
+	length := 0
+	chunk := make([]byte, min(streamChunk, capacity+1))
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n, readErr := r.Read(chunk)
+		if _, err := body.Write(chunk[:n]); err != nil {
+			return nil, fmt.Errorf("image too small to embed data: payload exceeds the capacity of %d bytes",
+				capacity)
+		}
+		length += n
+		stage.add(n)
+
+		if readErr == io.EOF {
+			break
 		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	if err := binary.Write(prefix, binary.BigEndian, uint32(length)); err != nil {
+		return nil, err
 	}
+	stage.finish()
 
 	return stego, nil
 }
 
 func (f *FractalStego) Extract(stego image.Image, config Config) ([]byte, error) {
-	if config.FractalParams == nil {
-		return nil, errors.New("fractal parameters are required")
+	return f.ExtractContext(context.Background(), stego, config, nil)
+}
+
+// ExtractContext is Extract that can be cancelled through ctx and reports its progress
+func (f *FractalStego) ExtractContext(ctx context.Context, stego image.Image, config Config, progress Progress) ([]byte, error) {
+	var data *bytes.Buffer
+	err := f.extract(ctx, stego, config, progress, func(length int) io.Writer {
+		data = bytes.NewBuffer(make([]byte, 0, length))
+		return data
+	})
+	if err != nil {
+		return nil, err
 	}
+	return data.Bytes(), nil
+}
 
-	bounds := stego.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
+// ExtractStream writes the hidden data to w, holding only one chunk of it at a time.
+// Nothing is written when the image does not hold a valid length.
+func (f *FractalStego) ExtractStream(stego image.Image, w io.Writer, config Config) error {
+	return f.ExtractStreamContext(context.Background(), stego, w, config, nil)
+}
 
-	pattern := f.generateFractalPattern(width, height, config.FractalParams)
+// ExtractStreamContext is ExtractStream that can be cancelled through ctx and reports its progress
+func (f *FractalStego) ExtractStreamContext(ctx context.Context, stego image.Image, w io.Writer, config Config, progress Progress) error {
+	return f.extract(ctx, stego, config, progress, func(int) io.Writer {
+		return w
+	})
+}
 
-	var length uint32
-	extractedBits := 0
-	lengthBytes := make([]byte, 4)
+// extract reads the length prefix, asks open for the writer of that many bytes
+// and copies the data to it chunk by chunk
+func (f *FractalStego) extract(ctx context.Context, stego image.Image, config Config, progress Progress, open func(length int) io.Writer) error {
+	params, err := fractalParams(config)
+	if err != nil {
+		return err
+	}
 
-	for y := 0; y < height && extractedBits < 32; y++ {
-		for x := 0; x < width && extractedBits < 32; x++ {
-			if pattern[y*width+x] {
-				c := color.RGBAModel.Convert(stego.At(x, y)).(color.RGBA)
-				bytePos := extractedBits / 8
-				bitPos := 7 - (extractedBits % 8)
-				lengthBytes[bytePos] |= (c.B & 1) << bitPos
-				extractedBits++
-			}
+	area, err := embeddingArea(stego.Bounds(), config.Region)
+	if err != nil {
+		return err
+	}
+	width := area.Dx()
+
+	order, err := f.carrierOrder(ctx, stego, area, params,
+		newProgressStage(progress, 0, patternShare, area.Dy()))
+	if err != nil {
+		return err
+	}
+	if len(order) < 32 {
+		return errors.New("invalid data length extracted")
+	}
+
+	lsb := lsbReader(stego)
+	// get reads bit number i of the embedded data from the pixel at order[i]
+	get := func(i int) byte {
+		pos := order[i]
+		return lsb(area.Min.X+pos%width, area.Min.Y+pos/width)
+	}
+	prefix := &bitReader{get: get, capacity: 32}
+	body := &bitReader{get: func(i int) byte { return get(32 + i) }, capacity: len(order) - 32}
+
+	// The length comes from the image, so it is checked against the capacity before anything is allocated
+	var length32 uint32
+	if err := binary.Read(prefix, binary.BigEndian, &length32); err != nil {
+		return err
+	}
+	length := int(length32)
+	if length == 0 || length > orderCapacity(order) {
+		return errors.New("invalid data length extracted")
+	}
+
+	w := open(length)
+	stage := newProgressStage(progress, patternShare, 1, length)
+	chunk := make([]byte, min(streamChunk, length))
+	for done := 0; done < length; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(body, chunk[:min(len(chunk), length-done)])
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return err
 		}
+		done += n
+		stage.add(n)
 	}
+	stage.finish()
 
-	length = binary.BigEndian.Uint32(lengthBytes)
-	if length == 0 || length > uint32(width*height) {
-		return nil, errors.New("invalid data length extracted")
+	return nil
+}
+
+func (f *FractalStego) Capacity(cover image.Image, config Config) (int, error) {
+	params, err := fractalParams(config)
+	if err != nil {
+		return 0, err
 	}
 
-	dataBits := make([]byte, length*8)
-	extractedBits = 0
+	area, err := embeddingArea(cover.Bounds(), config.Region)
+	if err != nil {
+		return 0, err
+	}
+	order, err := f.carrierOrder(context.Background(), cover, area, params, nil)
+	if err != nil {
+		return 0, err
+	}
+	return orderCapacity(order), nil
+}
 
-	skippedTimes := 0
-	for y := 0; y < height && extractedBits < len(dataBits); y++ {
-		for x := 0; x < width && extractedBits < len(dataBits); x++ {
-			pixelIndex := y*width + x
-			if skippedTimes < 32 && pattern[pixelIndex] {
-				skippedTimes++
-				continue
-			}
-			if pattern[pixelIndex] {
-				c := color.RGBAModel.Convert(stego.At(x, y)).(color.RGBA)
-				dataBits[extractedBits] = c.B & 1
-				extractedBits++
-			}
+// orderCapacity returns how many payload bytes fit into the pixels of an embedding order
+func orderCapacity(order []int) int {
+	if len(order) < 32 {
+		return 0
+	}
+	return (len(order) - 32) / 8
+}
+
+// carrierOrder returns the embedding order of the area of img without its fully transparent
+// pixels, whose color encoders and editors are free to discard. Embedding leaves the alpha
+// channel alone, so the stego image yields the same order as its cover.
+func (f *FractalStego) carrierOrder(ctx context.Context, img image.Image, area image.Rectangle, params *FractalParams, stage *progressStage) ([]int, error) {
+	order, err := f.embeddingOrder(ctx, area.Dx(), area.Dy(), params, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	transparent := transparency(img)
+	if transparent == nil {
+		return order, nil
+	}
+
+	// The order is a fresh slice, so it is filtered in place
+	width := area.Dx()
+	kept := order[:0]
+	for _, pos := range order {
+		if !transparent(area.Min.X+pos%width, area.Min.Y+pos/width) {
+			kept = append(kept, pos)
+		}
+	}
+	return kept, nil
+}
+
+// embeddingOrder returns the indices of the pixels that carry data, in the order bits are written.
+// Explicit parameters keep the scan order; a passphrase derives the fractal and scatters the
+// pixels with a keyed permutation. The rows of a pattern that is not cached are counted in stage.
+func (f *FractalStego) embeddingOrder(ctx context.Context, width, height int, params *FractalParams, stage *progressStage) ([]int, error) {
+	if params.Passphrase == "" {
+		key := maskKey{
+			width:       width,
+			height:      height,
+			fractalType: params.Type,
+			iterations:  params.Iterations,
+			threshold:   params.Threshold,
 		}
+		m, err := masks.get(key, func() (*mask, error) {
+			return f.generateFractalPattern(ctx, width, height, params, stage)
+		})
+		if err != nil {
+			return nil, err
+		}
+		stage.finish()
+		return m.Selected(), nil
+	}
+
+	fk, err := deriveFractalKey(params.Passphrase)
+	if err != nil {
+		return nil, err
 	}
 
-	return bitsToBytes(dataBits), nil
+	key := maskKey{width: width, height: height, passphrase: sha256.Sum256([]byte(params.Passphrase))}
+	m, err := masks.get(key, func() (*mask, error) {
+		return fk.pattern(ctx, width, height, stage)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stage.finish()
+	selected := m.Selected()
+
+	order := make([]int, len(selected))
+	for i, j := range slotPermutation(len(selected), fk.seed) {
+		order[i] = selected[j]
+	}
+	return order, nil
 }
 
-func (f *FractalStego) generateFractalPattern(width, height int, params *FractalParams) []bool {
-	pattern := make([]bool, width*height)
+// generateFractalPattern marks the pixels inside the fractal, computing row bands in parallel
+// and counting the finished rows in stage
+func (f *FractalStego) generateFractalPattern(ctx context.Context, width, height int, params *FractalParams, stage *progressStage) (*mask, error) {
+	pattern := newMask(width, height)
+	err := parallelRows(ctx, height, func(y0, y1 int) {
+		fractalRows(pattern, width, height, y0, y1, params)
+		stage.add(y1 - y0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pattern, nil
+}
 
-	for y := 0; y < height; y++ {
+// fractalRows fills rows [y0, y1) of the pattern; every pixel depends only on its own coordinates
+func fractalRows(pattern *mask, width, height, y0, y1 int, params *FractalParams) {
+	for y := y0; y < y1; y++ {
 		for x := 0; x < width; x++ {
 			nx := float64(x)/float64(width)*3.5 - 2.5
 			ny := float64(y)/float64(height)*2.0 - 1.0
@@ -131,29 +452,9 @@ func (f *FractalStego) generateFractalPattern(width, height int, params *Fractal
 				}
 			}
 
-			pattern[y*width+x] = iter == params.Iterations
-		}
-	}
-
-	return pattern
-}
-
-func bytesToBits(data []byte) []byte {
-	bits := make([]byte, len(data)*8)
-	for i, b := range data {
-		for j := 0; j < 8; j++ {
-			bits[i*8+j] = (b >> (7 - j)) & 1
-		}
-	}
-	return bits
-}
-
-func bitsToBytes(bits []byte) []byte {
-	bytes := make([]byte, (len(bits)+7)/8)
-	for i, bit := range bits {
-		if bit == 1 {
-			bytes[i/8] |= 1 << (7 - (i % 8))
+			if iter == params.Iterations {
+				pattern.set(x, y)
+			}
 		}
 	}
-	return bytes
 }
@@ -1,7 +1,9 @@
 package stego
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"image"
 	"image/color"
 	"math/rand"
@@ -72,11 +74,11 @@ func TestFractalEmbedExtract(t *testing.T) {
 			// Create config
 			config := Config{
 				EmbeddingRate: 0.5,
-				FractalParams: &FractalParams{
+				Params: FractalParams{
 					Type:       tc.fracType,
 					Iterations: tc.iterations,
 					Threshold:  tc.threshold,
-				},
+				}.Params(),
 			}
 
 			// Embed the data
@@ -136,12 +138,15 @@ func TestFractalPatternConsistency(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Generate the pattern twice with the same parameters
-			pattern1 := stego.generateFractalPattern(tc.width, tc.height, &FractalParams{Type: tc.fracType, Iterations: tc.iterations, Threshold: tc.threshold})
-			pattern2 := stego.generateFractalPattern(tc.width, tc.height, &FractalParams{Type: tc.fracType, Iterations: tc.iterations, Threshold: tc.threshold})
+			params := &FractalParams{Type: tc.fracType, Iterations: tc.iterations, Threshold: tc.threshold}
+			pattern1, err := stego.generateFractalPattern(context.Background(), tc.width, tc.height, params, nil)
+			require.NoError(t, err)
+			pattern2, err := stego.generateFractalPattern(context.Background(), tc.width, tc.height, params, nil)
+			require.NoError(t, err)
 
 			// The patterns should be identical
-			for i := 0; i < len(pattern1); i++ {
-				if pattern1[i] != pattern2[i] {
+			for i := 0; i < pattern1.Len(); i++ {
+				if pattern1.Get(i) != pattern2.Get(i) {
 					t.Errorf("Pattern generation is not consistent at index %d", i)
 					break
 				}
@@ -167,11 +172,11 @@ func TestFractalCapacity(t *testing.T) {
 
 	config := Config{
 		EmbeddingRate: 0.5,
-		FractalParams: &FractalParams{
+		Params: FractalParams{
 			Type:       "Mandelbrot",
 			Iterations: 100,
 			Threshold:  2.0,
-		},
+		}.Params(),
 	}
 
 	// Try to embed the data
@@ -193,7 +198,7 @@ func TestFractalParamsRequired(t *testing.T) {
 	// Create config without fractal parameters
 	config := Config{
 		EmbeddingRate: 0.5,
-		FractalParams: nil,
+		Params:        nil,
 	}
 
 	// Try to embed data
@@ -207,11 +212,11 @@ func TestFractalParamsRequired(t *testing.T) {
 	// Create a stego image
 	validConfig := Config{
 		EmbeddingRate: 0.5,
-		FractalParams: &FractalParams{
+		Params: FractalParams{
 			Type:       "Mandelbrot",
 			Iterations: 100,
 			Threshold:  2.0,
-		},
+		}.Params(),
 	}
 	stegoImg, _ := stego.Embed(cover, []byte("test"), validConfig)
 
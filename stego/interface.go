@@ -1,7 +1,9 @@
 package stego
 
 import (
+	"context"
 	"image"
+	"io"
 )
 
 // Steganographer is the interface that all steganography algorithms must implement
@@ -10,16 +12,57 @@ type Steganographer interface {
 	Embed(cover image.Image, data []byte, config Config) (image.Image, error)
 	// Extract extracts the hidden data from the stego image
 	Extract(stego image.Image, config Config) ([]byte, error)
-	// Name returns the name of the algorithm
+	// Capacity returns the maximum number of payload bytes the cover can hold
+	Capacity(cover image.Image, config Config) (int, error)
+	// Name returns the ID the algorithm is registered under; localized names are in its AlgorithmInfo
 	Name() string
 }
 
+// ContextSteganographer is implemented by algorithms whose long operations can be cancelled
+// and report their progress
+type ContextSteganographer interface {
+	Steganographer
+	// EmbedContext is Embed that stops with the context error when ctx is done
+	EmbedContext(ctx context.Context, cover image.Image, data []byte, config Config, progress Progress) (image.Image, error)
+	// ExtractContext is Extract that stops with the context error when ctx is done
+	ExtractContext(ctx context.Context, stego image.Image, config Config, progress Progress) ([]byte, error)
+}
+
+// StreamSteganographer is implemented by algorithms that move the payload through the image
+// chunk by chunk instead of holding it in memory whole
+type StreamSteganographer interface {
+	Steganographer
+	// EmbedStream embeds everything read from r into the cover image
+	EmbedStream(cover image.Image, r io.Reader, config Config) (image.Image, error)
+	// ExtractStream writes the hidden data of the stego image to w
+	ExtractStream(stego image.Image, w io.Writer, config Config) error
+	// EmbedStreamContext is EmbedStream that stops with the context error when ctx is done
+	EmbedStreamContext(ctx context.Context, cover image.Image, r io.Reader, config Config, progress Progress) (image.Image, error)
+	// ExtractStreamContext is ExtractStream that stops with the context error when ctx is done
+	ExtractStreamContext(ctx context.Context, stego image.Image, w io.Writer, config Config, progress Progress) error
+}
+
+// DeniableSteganographer is implemented by algorithms that can hide a decoy and a hidden
+// payload under two different keys in the same image
+type DeniableSteganographer interface {
+	Steganographer
+	// EmbedDeniable embeds the decoy and the optional hidden payload into disjoint keyed pixel subsets
+	EmbedDeniable(cover image.Image, decoy []byte, decoyKey string, hidden []byte, hiddenKey string, config Config) (image.Image, error)
+	// ExtractDeniable returns the payload unlocked by the key
+	ExtractDeniable(stego image.Image, key string, config Config) ([]byte, error)
+	// DeniableCapacity returns the maximum size of each of the two payloads
+	DeniableCapacity(cover image.Image, config Config) (int, error)
+}
+
 // Config holds configuration data needed for steganography algorithms
 type Config struct {
 	// EmbeddingRate is the proportion of available cover elements to use (0.0-1.0)
 	EmbeddingRate float64
-	// FractalParams contains parameters for fractal-based steganography
-	FractalParams *FractalParams
+	// Params holds the algorithm parameters described by the Schema of its AlgorithmInfo
+	Params Params
+	// Region, when not empty, restricts embedding to this rectangle. It is relative to the
+	// top-left corner of the image, so it still applies after the image is saved and reloaded.
+	Region image.Rectangle
 }
 
 // FractalParams contains configuration for fractal-based steganography
@@ -30,4 +73,16 @@ type FractalParams struct {
 	Iterations int
 	// Threshold is the escape radius for the fractal calculation
 	Threshold float64
+	// Passphrase, when set, derives the whole fractal and the pixel order instead of the fields above
+	Passphrase string
+}
+
+// Params returns the fractal parameters in their generic form
+func (p FractalParams) Params() Params {
+	return Params{
+		"type":       p.Type,
+		"iterations": p.Iterations,
+		"threshold":  p.Threshold,
+		"passphrase": p.Passphrase,
+	}
 }
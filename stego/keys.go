@@ -0,0 +1,136 @@
+package stego
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PEM block types used for key files
+const (
+	pemPrivateKey = "PRIVATE KEY"
+	pemPublicKey  = "PUBLIC KEY"
+)
+
+// GenerateRecipientKey creates a new X25519 key pair for payload encryption
+func GenerateRecipientKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// MarshalPrivateKey encodes a private key as a PKCS #8 PEM block
+func MarshalPrivateKey(key any) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPrivateKey, Bytes: der}), nil
+}
+
+// MarshalPublicKey encodes a public key as a PKIX PEM block
+func MarshalPublicKey(key any) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPublicKey, Bytes: der}), nil
+}
+
+// ParseRecipientKey reads an X25519 public key from PEM, base64 or hex text, or raw 32 bytes
+func ParseRecipientKey(data []byte) (*ecdh.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != pemPublicKey {
+			return nil, fmt.Errorf("unexpected PEM block %q, want %q", block.Type, pemPublicKey)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := key.(*ecdh.PublicKey)
+		if !ok || pub.Curve() != ecdh.X25519() {
+			return nil, errors.New("public key is not an X25519 key")
+		}
+		return pub, nil
+	}
+
+	raw, err := decodeRawKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// ParseIdentity reads an X25519 private key from PEM, base64 or hex text, or raw 32 bytes
+func ParseIdentity(data []byte) (*ecdh.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != pemPrivateKey {
+			return nil, fmt.Errorf("unexpected PEM block %q, want %q", block.Type, pemPrivateKey)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv, ok := key.(*ecdh.PrivateKey)
+		if !ok || priv.Curve() != ecdh.X25519() {
+			return nil, errors.New("private key is not an X25519 key")
+		}
+		return priv, nil
+	}
+
+	raw, err := decodeRawKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPrivateKey(raw)
+}
+
+// LoadRecipientKey reads an X25519 public key file
+func LoadRecipientKey(path string) (*ecdh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseRecipientKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadIdentity reads an X25519 private key file
+func LoadIdentity(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseIdentity(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// decodeRawKey accepts a 32-byte key as raw bytes, hex or base64 text
+func decodeRawKey(data []byte) ([]byte, error) {
+	if len(data) == x25519Size {
+		return data, nil
+	}
+
+	text := strings.TrimSpace(string(data))
+	if raw, err := hex.DecodeString(text); err == nil && len(raw) == x25519Size {
+		return raw, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err := enc.DecodeString(text); err == nil && len(raw) == x25519Size {
+			return raw, nil
+		}
+	}
+
+	return nil, errors.New("unrecognized key format")
+}
@@ -0,0 +1,274 @@
+package stego
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// mask is a bitset marking the pixels selected by a fractal pattern.
+// Each row starts on a word boundary so row bands can be filled concurrently.
+type mask struct {
+	width, height int
+	// stride is the number of words per row
+	stride int
+	words  []uint64
+}
+
+func newMask(width, height int) *mask {
+	stride := (width + 63) / 64
+	return &mask{width: width, height: height, stride: stride, words: make([]uint64, stride*height)}
+}
+
+// set marks the pixel at x, y
+func (m *mask) set(x, y int) {
+	m.words[y*m.stride+x/64] |= 1 << (x % 64)
+}
+
+// Len returns the number of pixels covered by the mask
+func (m *mask) Len() int {
+	return m.width * m.height
+}
+
+// Get reports whether the pixel with index i = y*width + x is selected
+func (m *mask) Get(i int) bool {
+	x, y := i%m.width, i/m.width
+	return m.words[y*m.stride+x/64]&(1<<(x%64)) != 0
+}
+
+// Count returns the number of selected pixels
+func (m *mask) Count() int {
+	n := 0
+	for _, w := range m.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Selected returns the indices of the selected pixels in scan order
+func (m *mask) Selected() []int {
+	pixels := make([]int, 0, m.Count())
+	for y := 0; y < m.height; y++ {
+		row := m.words[y*m.stride : (y+1)*m.stride]
+		for j, w := range row {
+			for w != 0 {
+				x := j*64 + bits.TrailingZeros64(w)
+				pixels = append(pixels, y*m.width+x)
+				w &= w - 1
+			}
+		}
+	}
+	return pixels
+}
+
+// size returns the memory held by the mask in bytes
+func (m *mask) size() int64 {
+	return int64(len(m.words)) * 8
+}
+
+// maskFileMagic starts every mask persisted on disk
+const maskFileMagic = "STGMASK1"
+
+// writeTo stores the mask as magic, width, height and the little-endian words
+func (m *mask) writeTo(w io.Writer) error {
+	header := make([]byte, 0, len(maskFileMagic)+8)
+	header = append(header, maskFileMagic...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(m.width))
+	header = binary.LittleEndian.AppendUint32(header, uint32(m.height))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, m.words)
+}
+
+// readMask loads a mask written by writeTo and checks it has the expected dimensions
+func readMask(r io.Reader, width, height int) (*mask, error) {
+	header := make([]byte, len(maskFileMagic)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(maskFileMagic)]) != maskFileMagic {
+		return nil, fmt.Errorf("not a mask file")
+	}
+	if int(binary.LittleEndian.Uint32(header[8:])) != width || int(binary.LittleEndian.Uint32(header[12:])) != height {
+		return nil, fmt.Errorf("mask file has different dimensions")
+	}
+
+	m := newMask(width, height)
+	if err := binary.Read(r, binary.LittleEndian, m.words); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// maskKey identifies a mask: the image size and everything the pattern depends on
+type maskKey struct {
+	width, height int
+	fractalType   string
+	iterations    int
+	threshold     float64
+	// passphrase is the SHA-256 of the passphrase of a derived fractal, zero otherwise.
+	// Masks with a passphrase stay in memory: on disk the key and the mask would let
+	// anyone test passphrases without going through the KDF.
+	passphrase [32]byte
+}
+
+// derived reports whether the mask depends on a passphrase
+func (k maskKey) derived() bool {
+	return k.passphrase != [32]byte{}
+}
+
+// fileName returns the name of the on-disk copy of a mask without a passphrase
+func (k maskKey) fileName() string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%d %d %q %d %v", k.width, k.height,
+		k.fractalType, k.iterations, k.threshold))
+	return hex.EncodeToString(sum[:]) + ".mask"
+}
+
+// MaskCacheOptions configures the cache of computed fractal masks
+type MaskCacheOptions struct {
+	// MaxBytes bounds the memory held by cached masks; zero disables the memory cache
+	MaxBytes int64
+	// Dir, when set, persists masks of at least DiskMinPixels pixels as files in this directory.
+	// Masks derived from a passphrase are never written to disk.
+	Dir string
+	// DiskMinPixels is the smallest image size, in pixels, worth persisting on disk
+	DiskMinPixels int
+}
+
+// DefaultMaskCacheOptions keeps up to 256 MiB of masks in memory and nothing on disk
+var DefaultMaskCacheOptions = MaskCacheOptions{
+	MaxBytes:      256 << 20,
+	DiskMinPixels: 8 << 20,
+}
+
+// maskEntry is a cached mask in the LRU list
+type maskEntry struct {
+	key  maskKey
+	mask *mask
+}
+
+// maskCache is an LRU cache of fractal masks bounded by their total size
+type maskCache struct {
+	mu      sync.Mutex
+	opts    MaskCacheOptions
+	entries map[maskKey]*list.Element
+	lru     *list.List
+	size    int64
+}
+
+func newMaskCache(opts MaskCacheOptions) *maskCache {
+	return &maskCache{opts: opts, entries: make(map[maskKey]*list.Element), lru: list.New()}
+}
+
+// masks is the process-wide mask cache used by the fractal algorithm
+var masks = newMaskCache(DefaultMaskCacheOptions)
+
+// ConfigureMaskCache replaces the mask cache settings and drops the masks held in memory
+func ConfigureMaskCache(opts MaskCacheOptions) {
+	masks.mu.Lock()
+	defer masks.mu.Unlock()
+
+	masks.opts = opts
+	masks.entries = make(map[maskKey]*list.Element)
+	masks.lru.Init()
+	masks.size = 0
+}
+
+// get returns the mask for key, from memory, from disk or computed by generate.
+// A mask whose generation fails, e.g. because it was cancelled, is not cached.
+func (c *maskCache) get(key maskKey, generate func() (*mask, error)) (*mask, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*maskEntry).mask, nil
+	}
+	opts := c.opts
+	c.mu.Unlock()
+
+	persist := opts.Dir != "" && !key.derived() && key.width*key.height >= opts.DiskMinPixels
+	var path string
+	var m *mask
+	if persist {
+		path = filepath.Join(opts.Dir, key.fileName())
+		m = loadMaskFile(path, key.width, key.height)
+	}
+	if m == nil {
+		var err error
+		m, err = generate()
+		if err != nil {
+			return nil, err
+		}
+		if persist {
+			// The disk copy is only an optimization, a failed write is recomputed next time
+			_ = saveMaskFile(path, m)
+		}
+	}
+
+	c.add(key, m)
+	return m, nil
+}
+
+// add stores a mask and evicts the least recently used ones beyond the size limit
+func (c *maskCache) add(key maskKey, m *mask) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok || m.size() > c.opts.MaxBytes {
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&maskEntry{key: key, mask: m})
+	c.size += m.size()
+	for c.size > c.opts.MaxBytes {
+		oldest := c.lru.Back()
+		entry := c.lru.Remove(oldest).(*maskEntry)
+		delete(c.entries, entry.key)
+		c.size -= entry.mask.size()
+	}
+}
+
+// loadMaskFile reads a persisted mask, returning nil if it is missing or unusable
+func loadMaskFile(path string, width, height int) *mask {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	m, err := readMask(file, width, height)
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// saveMaskFile writes a mask atomically through a temporary file
+func saveMaskFile(path string, m *mask) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mask-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := m.writeTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,127 @@
+package stego
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaskBitset tests the bitset against a plain list of selected pixels
+func TestMaskBitset(t *testing.T) {
+	t.Parallel()
+
+	const width, height = 70, 3
+	m := newMask(width, height)
+	want := []int{0, 63, 64, 69, 70, 139, 140 + 65}
+	for _, i := range want {
+		m.set(i%width, i/width)
+	}
+
+	assert.Equal(t, len(want), m.Count())
+	assert.Equal(t, want, m.Selected())
+	assert.True(t, m.Get(64))
+	assert.False(t, m.Get(65))
+	assert.Equal(t, width*height, m.Len())
+}
+
+// TestMaskCacheLRU tests that the least recently used masks are evicted first
+func TestMaskCacheLRU(t *testing.T) {
+	t.Parallel()
+
+	// Every 64x1 mask takes 8 bytes, so the cache holds two of them
+	cache := newMaskCache(MaskCacheOptions{MaxBytes: 16})
+	generated := 0
+	get := func(iterations int) {
+		cache.get(maskKey{width: 64, height: 1, iterations: iterations}, func() (*mask, error) {
+			generated++
+			return newMask(64, 1), nil
+		})
+	}
+
+	get(1)
+	get(2)
+	get(1)
+	assert.Equal(t, 2, generated)
+
+	get(3) // evicts 2
+	get(1)
+	assert.Equal(t, 3, generated)
+	get(2)
+	assert.Equal(t, 4, generated)
+}
+
+// TestMaskCacheDisk tests that large masks are persisted and read back instead of recomputed
+func TestMaskCacheDisk(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	params := &FractalParams{Type: "Mandelbrot", Iterations: 50, Threshold: 2}
+	key := maskKey{width: 90, height: 60, fractalType: params.Type, iterations: params.Iterations, threshold: params.Threshold}
+	want, err := NewFractalStego().generateFractalPattern(context.Background(), 90, 60, params, nil)
+	require.NoError(t, err)
+
+	cache := newMaskCache(MaskCacheOptions{Dir: dir, DiskMinPixels: 1000})
+	got, err := cache.get(key, func() (*mask, error) { return want, nil })
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.mask"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	fresh := newMaskCache(MaskCacheOptions{Dir: dir, DiskMinPixels: 1000})
+	got, err = fresh.get(key, func() (*mask, error) {
+		t.Error("mask was recomputed instead of loaded from disk")
+		return want, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// A damaged file is ignored and the mask recomputed
+	require.NoError(t, os.WriteFile(files[0], []byte("garbage"), 0644))
+	recomputed := false
+	newMaskCache(MaskCacheOptions{Dir: dir, DiskMinPixels: 1000}).get(key, func() (*mask, error) {
+		recomputed = true
+		return want, nil
+	})
+	assert.True(t, recomputed)
+
+	// Masks derived from a passphrase are never written to disk
+	derived := key
+	derived.passphrase = sha256.Sum256([]byte("secret"))
+	private := t.TempDir()
+	_, err = newMaskCache(MaskCacheOptions{Dir: private, DiskMinPixels: 1000}).get(derived, func() (*mask, error) { return want, nil })
+	require.NoError(t, err)
+	entries, err := os.ReadDir(private)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// BenchmarkEmbeddingOrder compares computing the embedding order with and without the mask cache
+func BenchmarkEmbeddingOrder(b *testing.B) {
+	const width, height = 1000, 1000
+	params := &FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}
+	stego := NewFractalStego()
+
+	b.Run("uncached", func(b *testing.B) {
+		for range b.N {
+			pattern, err := stego.generateFractalPattern(context.Background(), width, height, params, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			pattern.Selected()
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for range b.N {
+			if _, err := stego.embeddingOrder(context.Background(), width, height, params, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,302 @@
+package stego
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+func init() {
+	Register(AlgorithmInfo{
+		ID: "palette",
+		Names: map[string]string{
+			"en": "Palette",
+			"ru": "Палитра",
+		},
+		Descriptions: map[string]string{
+			"en": "Hides data in paletted images such as GIFs by swapping pixels between neighbouring colors of the luminance-sorted palette, keeping the image paletted",
+			"ru": "Скрывает данные в палитровых изображениях, например GIF, заменяя цвет пикселя соседним в отсортированной по яркости палитре; изображение остаётся палитровым",
+		},
+		Schema:     paletteSchema,
+		Candidates: []Params{{"passphrase": ""}},
+		New: func() Steganographer {
+			return NewPaletteStego()
+		},
+		KeepsPalette: true,
+	})
+}
+
+// paletteSchema describes the parameters of the palette algorithm
+var paletteSchema = Schema{
+	{
+		Name:   "passphrase",
+		Kind:   ParamString,
+		Labels: map[string]string{"en": "Passphrase", "ru": "Парольная фраза"},
+		Help: map[string]string{
+			"en": "Scatters the data over the image in a keyed order instead of the scan order",
+			"ru": "Распределяет данные по изображению в порядке, заданном ключом, а не построчно",
+		},
+		Default: "",
+		Secret:  true,
+	},
+}
+
+// paletteSalt separates the palette order derivation from every other use of the passphrase
+const paletteSalt = "kursovaya palette passphrase"
+
+// ErrNotPaletted is returned when the palette algorithm is given an image without a palette
+var ErrNotPaletted = errors.New("palette algorithm requires a paletted image such as a GIF or a palette PNG")
+
+// PaletteStego is an EzStego-style algorithm: the palette is sorted by luminance and split
+// into pairs of neighbouring colors, and a pixel carries the position of its color inside
+// the pair. Embedding only swaps a pixel to the other color of its pair, so the image keeps
+// its palette and stays visually close to the cover.
+type PaletteStego struct{}
+
+func NewPaletteStego() *PaletteStego {
+	return &PaletteStego{}
+}
+
+func (p *PaletteStego) Name() string {
+	return "palette"
+}
+
+// paletteSeeds caches the permutation seeds by the SHA-256 of the passphrase, since the KDF is slow on purpose
+var paletteSeeds = newDerivedCache[[32]byte]()
+
+// paletteSeed stretches a passphrase into the seed of the keyed pixel order
+func paletteSeed(passphrase string) ([32]byte, error) {
+	id := sha256.Sum256([]byte(passphrase))
+	if seed, ok := paletteSeeds.get(id); ok {
+		return seed, nil
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, []byte(paletteSalt), passphraseIterations, 32)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	var seed [32]byte
+	copy(seed[:], key)
+	paletteSeeds.add(id, seed)
+	return seed, nil
+}
+
+// palettePairs pairs up the entries of a palette. partner[i] is the index of the color
+// swapped with entry i, or -1 when the entry carries no data, and bit[i] is the bit the
+// entry stands for. Entries are sorted by alpha, then luminance, then index, and neighbours
+// with the same alpha form a pair; fully transparent entries are left out, like fully
+// transparent pixels in the other algorithms.
+func palettePairs(palette color.Palette) (partner []int, bit []byte) {
+	type entry struct {
+		index     int
+		alpha     uint32
+		luminance uint32
+	}
+
+	entries := make([]entry, 0, len(palette))
+	for i, c := range palette {
+		// Pixels address at most 256 colors
+		if i > 0xFF {
+			break
+		}
+		r, g, b, a := c.RGBA()
+		if a == 0 {
+			continue
+		}
+		entries = append(entries, entry{i, a, (299*r + 587*g + 114*b) / 1000})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.alpha != b.alpha {
+			return a.alpha < b.alpha
+		}
+		if a.luminance != b.luminance {
+			return a.luminance < b.luminance
+		}
+		return a.index < b.index
+	})
+
+	partner = make([]int, len(palette))
+	bit = make([]byte, len(palette))
+	for i := range partner {
+		partner[i] = -1
+	}
+	for i := 0; i+1 < len(entries); {
+		a, b := entries[i], entries[i+1]
+		if a.alpha != b.alpha {
+			i++
+			continue
+		}
+		partner[a.index], partner[b.index] = b.index, a.index
+		bit[b.index] = 1
+		i += 2
+	}
+	return partner, bit
+}
+
+// paletteOrder returns the positions in img.Pix of the pixels of the area whose color has a
+// partner, in the order bits are written. Swapping a pixel to its partner keeps it in the
+// set, so the stego image yields the same order as its cover.
+func paletteOrder(img *image.Paletted, area image.Rectangle, partner []int, passphrase string) ([]int, error) {
+	var order []int
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			if idx := int(img.Pix[i]); idx < len(partner) && partner[idx] >= 0 {
+				order = append(order, i)
+			}
+		}
+	}
+	if passphrase == "" {
+		return order, nil
+	}
+
+	seed, err := paletteSeed(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	scattered := make([]int, len(order))
+	for i, j := range slotPermutation(len(order), seed) {
+		scattered[i] = order[j]
+	}
+	return scattered, nil
+}
+
+// gifPaletteSize returns the size of the color table a GIF encoder writes for n colors.
+// The decoder returns all of its entries, so a palette of this size survives the round trip.
+func gifPaletteSize(n int) int {
+	size := 2
+	for size < n {
+		size *= 2
+	}
+	return size
+}
+
+// clonePaletted copies the image and pads its palette with opaque black to the size it has
+// after saving as GIF, so the pairs do not change when the stego image is reloaded
+func clonePaletted(img *image.Paletted) *image.Paletted {
+	palette := make(color.Palette, len(img.Palette), max(len(img.Palette), gifPaletteSize(len(img.Palette))))
+	copy(palette, img.Palette)
+	for len(palette) < cap(palette) {
+		palette = append(palette, color.RGBA{A: 0xFF})
+	}
+
+	out := image.NewPaletted(img.Rect, palette)
+	copy(out.Pix, img.Pix)
+	return out
+}
+
+// paletteConfig checks the parameters and the image and returns the paletted image with the
+// embedding area
+func paletteConfig(img image.Image, config Config) (*image.Paletted, image.Rectangle, string, error) {
+	params, err := paletteSchema.Resolve(config.Params)
+	if err != nil {
+		return nil, image.Rectangle{}, "", err
+	}
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		return nil, image.Rectangle{}, "", ErrNotPaletted
+	}
+	area, err := embeddingArea(img.Bounds(), config.Region)
+	if err != nil {
+		return nil, image.Rectangle{}, "", err
+	}
+	return paletted, area, params.String("passphrase"), nil
+}
+
+func (p *PaletteStego) Embed(cover image.Image, data []byte, config Config) (image.Image, error) {
+	paletted, area, passphrase, err := paletteConfig(cover, config)
+	if err != nil {
+		return nil, err
+	}
+
+	stego := clonePaletted(paletted)
+	partner, bit := palettePairs(stego.Palette)
+	order, err := paletteOrder(stego, area, partner, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := orderCapacity(order)
+	if len(data) > capacity {
+		return nil, fmt.Errorf("image too small to embed data: payload is %d bytes, capacity is %d bytes",
+			len(data), capacity)
+	}
+
+	// set moves the pixel at order[i] to the color of its pair that stands for the bit
+	w := &bitWriter{
+		set: func(i int, b byte) {
+			pos := order[i]
+			if idx := stego.Pix[pos]; bit[idx] != b {
+				stego.Pix[pos] = uint8(partner[idx])
+			}
+		},
+		capacity: len(order),
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	return stego, nil
+}
+
+func (p *PaletteStego) Extract(stego image.Image, config Config) ([]byte, error) {
+	paletted, area, passphrase, err := paletteConfig(stego, config)
+	if err != nil {
+		return nil, err
+	}
+
+	partner, bit := palettePairs(paletted.Palette)
+	order, err := paletteOrder(paletted, area, partner, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) < 32 {
+		return nil, errors.New("invalid data length extracted")
+	}
+
+	r := &bitReader{
+		get:      func(i int) byte { return bit[paletted.Pix[order[i]]] },
+		capacity: len(order),
+	}
+
+	// The length comes from the image, so it is checked against the capacity before anything is allocated
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if length == 0 || int(length) > orderCapacity(order) {
+		return nil, errors.New("invalid data length extracted")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (p *PaletteStego) Capacity(cover image.Image, config Config) (int, error) {
+	paletted, area, _, err := paletteConfig(cover, config)
+	if err != nil {
+		return 0, err
+	}
+
+	// The pairs are those of the padded palette the stego image gets. The keyed order
+	// holds the same pixels, so the slow key derivation is skipped.
+	partner, _ := palettePairs(clonePaletted(paletted).Palette)
+	order, err := paletteOrder(paletted, area, partner, "")
+	if err != nil {
+		return 0, err
+	}
+	return orderCapacity(order), nil
+}
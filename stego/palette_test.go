@@ -0,0 +1,127 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomPaletted returns a random image over a palette of 20 colors, one of them transparent
+func randomPaletted(width, height int, seed int64) *image.Paletted {
+	rnd := rand.New(rand.NewSource(seed))
+	palette := color.Palette{color.RGBA{}}
+	for len(palette) < 20 {
+		palette = append(palette, color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 0xFF})
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(len(palette)))
+	}
+	return img
+}
+
+// TestPalettePairs tests that neighbours in luminance order are paired, leaving the odd color
+// and transparent colors out
+func TestPalettePairs(t *testing.T) {
+	t.Parallel()
+
+	palette := color.Palette{
+		color.Gray{Y: 0xFF},
+		color.RGBA{},
+		color.Gray{Y: 0x10},
+		color.Gray{Y: 0xE0},
+		color.Gray{Y: 0x00},
+		color.Gray{Y: 0x80},
+	}
+	partner, bit := palettePairs(palette)
+
+	assert.Equal(t, []int{-1, -1, 4, 5, 2, 3}, partner)
+	assert.Equal(t, []byte{0, 0, 1, 1, 0, 0}, bit)
+}
+
+// TestPaletteRoundTrip tests that the stego image stays paletted, only swaps colors within
+// their pairs and keeps the payload when saved as GIF or PNG
+func TestPaletteRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	cover := randomPaletted(120, 90, 7)
+	s := NewPaletteStego()
+	data := []byte("a payload that rides in the palette")
+
+	encoders := map[string]func(*bytes.Buffer, image.Image) error{
+		"GIF": func(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) },
+		"PNG": func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) },
+	}
+
+	for _, passphrase := range []string{"", "palette passphrase"} {
+		config := Config{Params: Params{"passphrase": passphrase}}
+
+		stegoImage, err := s.Embed(cover, data, config)
+		require.NoError(t, err)
+		paletted, ok := stegoImage.(*image.Paletted)
+		require.True(t, ok, "stego image is %T", stegoImage)
+		assert.Len(t, paletted.Palette, 32)
+
+		partner, _ := palettePairs(paletted.Palette)
+		for i, idx := range cover.Pix {
+			if paletted.Pix[i] != idx {
+				require.Equal(t, partner[idx], int(paletted.Pix[i]), "pixel %d left its pair", i)
+			}
+		}
+
+		for name, encode := range encoders {
+			var buf bytes.Buffer
+			require.NoError(t, encode(&buf, stegoImage), name)
+			decoded, _, err := image.Decode(&buf)
+			require.NoError(t, err, name)
+
+			extracted, err := s.Extract(decoded, config)
+			require.NoError(t, err, name)
+			assert.Equal(t, data, extracted, "%s, passphrase %q", name, passphrase)
+		}
+	}
+}
+
+// TestPaletteCapacity tests that a payload of exactly the capacity fits and one more byte does not
+func TestPaletteCapacity(t *testing.T) {
+	t.Parallel()
+
+	cover := randomPaletted(64, 64, 8)
+	s := NewPaletteStego()
+	config := Config{Params: Params{}}
+
+	capacity, err := s.Capacity(cover, config)
+	require.NoError(t, err)
+	require.Positive(t, capacity)
+
+	data := bytes.Repeat([]byte{0xA5}, capacity)
+	stegoImage, err := s.Embed(cover, data, config)
+	require.NoError(t, err)
+	extracted, err := s.Extract(stegoImage, config)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+
+	_, err = s.Embed(cover, append(data, 0), config)
+	assert.Error(t, err)
+}
+
+// TestPaletteNotPaletted tests that true-color images are refused instead of converted
+func TestPaletteNotPaletted(t *testing.T) {
+	t.Parallel()
+
+	s := NewPaletteStego()
+	cover := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+
+	_, err := s.Embed(cover, []byte("x"), Config{})
+	assert.ErrorIs(t, err, ErrNotPaletted)
+	_, err = s.Extract(cover, Config{})
+	assert.ErrorIs(t, err, ErrNotPaletted)
+}
@@ -0,0 +1,51 @@
+package stego
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// rowBand is the number of rows a worker claims at a time. Bands are handed out
+// on demand because rows inside the set cost far more iterations than the rest.
+const rowBand = 16
+
+// parallelRows calls fn for consecutive bands of rows covering [0, height)
+// on a pool of GOMAXPROCS workers and returns when all bands are done.
+// Once ctx is done no more bands are started and the context error is returned.
+func parallelRows(ctx context.Context, height int, fn func(y0, y1 int)) error {
+	return parallelRowsN(ctx, height, runtime.GOMAXPROCS(0), fn)
+}
+
+// parallelRowsN is parallelRows with an explicit number of workers
+func parallelRowsN(ctx context.Context, height, workers int, fn func(y0, y1 int)) error {
+	workers = min(workers, (height+rowBand-1)/rowBand)
+	if workers <= 1 {
+		for y0 := 0; y0 < height; y0 += rowBand {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			fn(y0, min(y0+rowBand, height))
+		}
+		return ctx.Err()
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				y0 := int(next.Add(rowBand)) - rowBand
+				if y0 >= height || ctx.Err() != nil {
+					return
+				}
+				fn(y0, min(y0+rowBand, height))
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
@@ -0,0 +1,78 @@
+package stego
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serialPattern computes the fractal pattern on a single goroutine, as a reference
+func serialPattern(width, height int, params *FractalParams) *mask {
+	pattern := newMask(width, height)
+	fractalRows(pattern, width, height, 0, height, params)
+	return pattern
+}
+
+// TestParallelPatternIdentical tests that the parallel pattern is bit-identical to the serial one
+func TestParallelPatternIdentical(t *testing.T) {
+	t.Parallel()
+
+	key, err := deriveFractalKey("parallel")
+	require.NoError(t, err)
+
+	for _, size := range [][2]int{{1, 1}, {37, 5}, {123, 77}, {300, 200}} {
+		width, height := size[0], size[1]
+		params := &FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}
+		want := serialPattern(width, height, params)
+
+		wantKeyed := newMask(width, height)
+		key.rows(wantKeyed, width, height, 0, height)
+
+		for _, workers := range []int{2, 3, 8} {
+			got := newMask(width, height)
+			parallelRowsN(context.Background(), height, workers, func(y0, y1 int) {
+				fractalRows(got, width, height, y0, y1, params)
+			})
+			assert.Equal(t, want, got, "%dx%d with %d workers", width, height, workers)
+
+			gotKeyed := newMask(width, height)
+			parallelRowsN(context.Background(), height, workers, func(y0, y1 int) {
+				key.rows(gotKeyed, width, height, y0, y1)
+			})
+			assert.Equal(t, wantKeyed, gotKeyed, "%dx%d keyed with %d workers", width, height, workers)
+		}
+	}
+}
+
+// BenchmarkFractalPattern compares serial and parallel pattern generation on a 3-megapixel image
+func BenchmarkFractalPattern(b *testing.B) {
+	const width, height = 2000, 1500
+	params := &FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}
+	stego := NewFractalStego()
+
+	b.Run("serial", func(b *testing.B) {
+		for range b.N {
+			serialPattern(width, height, params)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for range b.N {
+			if _, err := stego.generateFractalPattern(context.Background(), width, height, params, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				pattern := newMask(width, height)
+				parallelRowsN(context.Background(), height, workers, func(y0, y1 int) {
+					fractalRows(pattern, width, height, y0, y1, params)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package stego
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamKind is the value type of an algorithm parameter
+type ParamKind int
+
+const (
+	// ParamInt is an integer parameter stored as int
+	ParamInt ParamKind = iota
+	// ParamFloat is a real parameter stored as float64
+	ParamFloat
+	// ParamEnum is a string parameter restricted to its choices
+	ParamEnum
+	// ParamString is a free-form string parameter
+	ParamString
+)
+
+// Params holds algorithm parameters keyed by parameter name.
+// Values are int, float64 or string according to the kind of their ParamSpec.
+type Params map[string]any
+
+// Int returns an integer parameter, zero if it is missing
+func (p Params) Int(name string) int {
+	v, _ := p[name].(int)
+	return v
+}
+
+// Float returns a real parameter, zero if it is missing
+func (p Params) Float(name string) float64 {
+	v, _ := p[name].(float64)
+	return v
+}
+
+// String returns a string parameter, empty if it is missing
+func (p Params) String(name string) string {
+	v, _ := p[name].(string)
+	return v
+}
+
+// Summary returns the parameters as name=value pairs sorted by name
+func (p Params) Summary() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%v", name, p[name])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Choice is an allowed value of an enum parameter
+type Choice struct {
+	// Value is the stable value stored in Params
+	Value string
+	// Labels holds the display names keyed by language
+	Labels map[string]string
+}
+
+// ParamSpec describes one algorithm parameter
+type ParamSpec struct {
+	// Name is the ASCII key of the parameter in Params, profiles and command line flags
+	Name string
+	// Kind is the value type
+	Kind ParamKind
+	// Labels holds the form labels keyed by language
+	Labels map[string]string
+	// Help holds a short explanation keyed by language
+	Help map[string]string
+	// Min and Max bound numeric values inclusively; the range is not checked when both are zero
+	Min, Max float64
+	// Default is the value used when the parameter is not given
+	Default any
+	// Choices lists the allowed values of an enum parameter
+	Choices []Choice
+	// Secret marks values that must not be shown or stored, such as passphrases
+	Secret bool
+}
+
+// Label returns the form label of the parameter in the given language
+func (s ParamSpec) Label(lang string) string {
+	return localized(s.Labels, lang, s.Name)
+}
+
+// HelpText returns the explanation of the parameter in the given language
+func (s ParamSpec) HelpText(lang string) string {
+	return localized(s.Help, lang, "")
+}
+
+// ChoiceLabel returns the display name of an enum value in the given language
+func (s ParamSpec) ChoiceLabel(value, lang string) string {
+	for _, choice := range s.Choices {
+		if choice.Value == value {
+			return localized(choice.Labels, lang, value)
+		}
+	}
+	return value
+}
+
+// Parse converts text entered by the user into a checked parameter value.
+// Enum parameters accept the value or any of its display names.
+func (s ParamSpec) Parse(text string) (any, error) {
+	text = strings.TrimSpace(text)
+
+	switch s.Kind {
+	case ParamInt:
+		v, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %q is not an integer", s.Name, text)
+		}
+		return s.Check(v)
+	case ParamFloat:
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %q is not a number", s.Name, text)
+		}
+		return s.Check(v)
+	case ParamEnum:
+		for _, choice := range s.Choices {
+			if choice.Value == text {
+				return choice.Value, nil
+			}
+			for _, label := range choice.Labels {
+				if label == text {
+					return choice.Value, nil
+				}
+			}
+		}
+		return s.Check(text)
+	default:
+		return s.Check(text)
+	}
+}
+
+// Check verifies a value against the spec and converts it to the type of its kind.
+// Integral float64 values, as decoded from JSON, are accepted for integer parameters.
+func (s ParamSpec) Check(v any) (any, error) {
+	switch s.Kind {
+	case ParamInt:
+		var n int
+		switch v := v.(type) {
+		case int:
+			n = v
+		case int64:
+			n = int(v)
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("invalid %s value: %v is not an integer", s.Name, v)
+			}
+			n = int(v)
+		default:
+			return nil, fmt.Errorf("invalid %s value: %v is not an integer", s.Name, v)
+		}
+		if err := s.checkRange(float64(n)); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	case ParamFloat:
+		var f float64
+		switch v := v.(type) {
+		case float64:
+			f = v
+		case int:
+			f = float64(v)
+		case int64:
+			f = float64(v)
+		default:
+			return nil, fmt.Errorf("invalid %s value: %v is not a number", s.Name, v)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("invalid %s value: %v", s.Name, f)
+		}
+		if err := s.checkRange(f); err != nil {
+			return nil, err
+		}
+		return f, nil
+
+	case ParamEnum:
+		text, ok := v.(string)
+		if ok {
+			for _, choice := range s.Choices {
+				if choice.Value == text {
+					return text, nil
+				}
+			}
+		}
+		values := make([]string, len(s.Choices))
+		for i, choice := range s.Choices {
+			values[i] = choice.Value
+		}
+		return nil, fmt.Errorf("invalid %s value: %v, must be one of %s", s.Name, v, strings.Join(values, ", "))
+
+	default:
+		text, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value: %v is not a string", s.Name, v)
+		}
+		return text, nil
+	}
+}
+
+// checkRange verifies that a numeric value lies within Min and Max
+func (s ParamSpec) checkRange(v float64) error {
+	if s.Min == 0 && s.Max == 0 {
+		return nil
+	}
+	if v < s.Min || v > s.Max {
+		return fmt.Errorf("invalid %s value: %v, must be between %v and %v", s.Name, v, s.Min, s.Max)
+	}
+	return nil
+}
+
+// FormatValue returns a parameter value as text that Parse accepts
+func (s ParamSpec) FormatValue(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// Schema lists the parameters of an algorithm in form order
+type Schema []ParamSpec
+
+// Lookup finds a parameter by name
+func (s Schema) Lookup(name string) (ParamSpec, bool) {
+	for _, spec := range s {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return ParamSpec{}, false
+}
+
+// Public returns the parameters without the secret ones, for display and storage
+func (s Schema) Public(params Params) Params {
+	public := make(Params, len(params))
+	for name, v := range params {
+		if spec, ok := s.Lookup(name); !ok || !spec.Secret {
+			public[name] = v
+		}
+	}
+	return public
+}
+
+// Defaults returns the default value of every parameter
+func (s Schema) Defaults() Params {
+	params := make(Params, len(s))
+	for _, spec := range s {
+		params[spec.Name] = spec.Default
+	}
+	return params
+}
+
+// Resolve checks the given parameters, fills in defaults for the missing ones
+// and rejects names the schema does not know
+func (s Schema) Resolve(params Params) (Params, error) {
+	for name := range params {
+		if _, ok := s.Lookup(name); !ok {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+
+	resolved := make(Params, len(s))
+	for _, spec := range s {
+		v, ok := params[spec.Name]
+		if !ok {
+			v = spec.Default
+		}
+		checked, err := spec.Check(v)
+		if err != nil {
+			return nil, err
+		}
+		resolved[spec.Name] = checked
+	}
+	return resolved, nil
+}
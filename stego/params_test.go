@@ -0,0 +1,46 @@
+package stego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSchemaResolve tests that parameters are checked and completed from the defaults
+func TestSchemaResolve(t *testing.T) {
+	t.Parallel()
+
+	params, err := fractalSchema.Resolve(Params{"iterations": 50.0})
+	require.NoError(t, err)
+	assert.Equal(t, Params{"type": "Mandelbrot", "iterations": 50, "threshold": 2.0, "passphrase": ""}, params)
+
+	_, err = fractalSchema.Resolve(Params{"iterations": 0})
+	assert.Error(t, err)
+	_, err = fractalSchema.Resolve(Params{"iterations": 1.5})
+	assert.Error(t, err)
+	_, err = fractalSchema.Resolve(Params{"type": "Sierpinski"})
+	assert.Error(t, err)
+	_, err = fractalSchema.Resolve(Params{"radius": 2.0})
+	assert.Error(t, err)
+}
+
+// TestParamParse tests parsing of form input, including localized enum labels
+func TestParamParse(t *testing.T) {
+	t.Parallel()
+
+	typeSpec, _ := fractalSchema.Lookup("type")
+	v, err := typeSpec.Parse("Жулиа")
+	require.NoError(t, err)
+	assert.Equal(t, "Julia", v)
+	assert.Equal(t, "Мандельброт", typeSpec.ChoiceLabel("Mandelbrot", "ru"))
+
+	thresholdSpec, _ := fractalSchema.Lookup("threshold")
+	v, err = thresholdSpec.Parse(" 2.5 ")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, v)
+	assert.Equal(t, "2.5", thresholdSpec.FormatValue(v))
+
+	_, err = thresholdSpec.Parse("abc")
+	assert.Error(t, err)
+}
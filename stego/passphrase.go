@@ -0,0 +1,237 @@
+package stego
+
+import (
+	"container/list"
+	"context"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"errors"
+	"math"
+	mrand "math/rand/v2"
+	"sync"
+	"time"
+)
+
+// passphraseIterations is the PBKDF2-SHA256 work factor for passphrase-derived fractals.
+// The salt is fixed because nothing is stored in the image to carry a random one.
+const passphraseIterations = 600000
+
+// passphraseSalt separates the fractal key derivation from every other use of the passphrase
+const passphraseSalt = "kursovaya fractal passphrase"
+
+// Coverage bounds for a derived fractal: the share of probe points inside the set must lie
+// between them, so the viewport is neither empty nor a solid block
+const (
+	minCoverage = 0.2
+	maxCoverage = 0.8
+)
+
+// coverageProbe is the side of the square grid used to measure the coverage of a viewport
+const coverageProbe = 48
+
+// maxViewportAttempts bounds the search for a viewport with a usable coverage
+const maxViewportAttempts = 10000
+
+// fractalKey is a fractal fully specified by a passphrase
+type fractalKey struct {
+	// julia selects the Julia family with constant c, otherwise the Mandelbrot set
+	julia bool
+	c     complex128
+	// center and halfWidth place the viewport; its height follows the image aspect ratio
+	center    complex128
+	halfWidth float64
+	// iterations and threshold control the escape test
+	iterations int
+	threshold  float64
+	// seed keys the permutation of the selected pixels
+	seed [32]byte
+}
+
+// Derived secrets are cached because the KDF is slow on purpose, but only for the few
+// passphrases in use and only for a while, so they do not stay in a long-running process
+const (
+	derivedCacheSize = 4
+	derivedCacheTTL  = 10 * time.Minute
+)
+
+// derivedEntry is a cached derived secret in the LRU list
+type derivedEntry[V any] struct {
+	id    [32]byte
+	value V
+	timer *time.Timer
+}
+
+// derivedCache is a small LRU cache of values derived from passphrases, keyed by the SHA-256
+// of the passphrase. Entries are forgotten after derivedCacheTTL even when nothing is looked up.
+type derivedCache[V any] struct {
+	mu      sync.Mutex
+	entries map[[32]byte]*list.Element
+	lru     *list.List
+}
+
+func newDerivedCache[V any]() *derivedCache[V] {
+	return &derivedCache[V]{entries: make(map[[32]byte]*list.Element), lru: list.New()}
+}
+
+// get returns the value cached for the passphrase hash id
+func (c *derivedCache[V]) get(id [32]byte) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*derivedEntry[V]).value, true
+}
+
+// add stores a value, evicting the least recently used one beyond derivedCacheSize
+func (c *derivedCache[V]) add(id [32]byte, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[id]; ok {
+		return
+	}
+	entry := &derivedEntry[V]{id: id, value: value}
+	elem := c.lru.PushFront(entry)
+	c.entries[id] = elem
+	entry.timer = time.AfterFunc(derivedCacheTTL, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.entries[id] == elem {
+			c.removeLocked(elem)
+		}
+	})
+	for c.lru.Len() > derivedCacheSize {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// delete forgets the value cached for id
+func (c *derivedCache[V]) delete(id [32]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[id]; ok {
+		c.removeLocked(elem)
+	}
+}
+
+// removeLocked drops an entry; c.mu must be held
+func (c *derivedCache[V]) removeLocked(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*derivedEntry[V])
+	entry.timer.Stop()
+	delete(c.entries, entry.id)
+}
+
+// fractalKeys caches derived keys by the SHA-256 of the passphrase
+var fractalKeys = newDerivedCache[*fractalKey]()
+
+// deriveFractalKey stretches a passphrase into the fractal family, the viewport center and zoom,
+// the Julia constant, the iteration count and the pixel permutation seed
+func deriveFractalKey(passphrase string) (*fractalKey, error) {
+	id := sha256.Sum256([]byte(passphrase))
+	if key, ok := fractalKeys.get(id); ok {
+		return key, nil
+	}
+
+	master, err := pbkdf2.Key(sha256.New, passphrase, []byte(passphraseSalt), passphraseIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	paramSeed, err := hkdf.Key(sha256.New, master, nil, "kursovaya fractal parameters", 32)
+	if err != nil {
+		return nil, err
+	}
+	permSeed, err := hkdf.Key(sha256.New, master, nil, "kursovaya fractal permutation", 32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &fractalKey{threshold: 2}
+	copy(key.seed[:], permSeed)
+
+	var seed [32]byte
+	copy(seed[:], paramSeed)
+	rng := mrand.New(mrand.NewChaCha8(seed))
+
+	key.julia = rng.IntN(2) == 1
+	key.iterations = 64 + rng.IntN(448)
+
+	// Draw viewports until one covers a usable share of the probe grid
+	for attempt := 0; ; attempt++ {
+		if attempt == maxViewportAttempts {
+			return nil, errors.New("passphrase does not yield a usable fractal")
+		}
+
+		// Zoom from 1x to 64x on a log scale
+		key.halfWidth = 1.5 / math.Exp2(rng.Float64()*6)
+		if key.julia {
+			key.c = complex(rng.Float64()*2-1.5, rng.Float64()*2-1)
+			key.center = complex(rng.Float64()*2-1, rng.Float64()*2-1)
+		} else {
+			key.center = complex(rng.Float64()*2.5-2, rng.Float64()*2.5-1.25)
+		}
+
+		probe, err := key.pattern(context.Background(), coverageProbe, coverageProbe, nil)
+		if err != nil {
+			return nil, err
+		}
+		share := float64(probe.Count()) / (coverageProbe * coverageProbe)
+		if share >= minCoverage && share <= maxCoverage {
+			break
+		}
+	}
+
+	fractalKeys.add(id, key)
+	return key, nil
+}
+
+// pattern marks the pixels of a width x height image whose points do not escape,
+// computing row bands in parallel and counting the finished rows in stage
+func (k *fractalKey) pattern(ctx context.Context, width, height int, stage *progressStage) (*mask, error) {
+	pattern := newMask(width, height)
+	err := parallelRows(ctx, height, func(y0, y1 int) {
+		k.rows(pattern, width, height, y0, y1)
+		stage.add(y1 - y0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pattern, nil
+}
+
+// rows fills rows [y0, y1) of the pattern
+func (k *fractalKey) rows(pattern *mask, width, height, y0, y1 int) {
+	halfHeight := k.halfWidth * float64(height) / float64(width)
+	limit := k.threshold * k.threshold
+
+	for y := y0; y < y1; y++ {
+		for x := 0; x < width; x++ {
+			p := k.center + complex(
+				(2*(float64(x)+0.5)/float64(width)-1)*k.halfWidth,
+				(2*(float64(y)+0.5)/float64(height)-1)*halfHeight,
+			)
+
+			z, c := p, k.c
+			if !k.julia {
+				z, c = 0, p
+			}
+
+			iter := 0
+			for ; iter < k.iterations; iter++ {
+				z = z*z + c
+				if real(z)*real(z)+imag(z)*imag(z) > limit {
+					break
+				}
+			}
+
+			if iter == k.iterations {
+				pattern.set(x, y)
+			}
+		}
+	}
+}
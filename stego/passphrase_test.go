@@ -0,0 +1,69 @@
+package stego
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPassphraseEmbedExtract tests that a passphrase alone embeds and extracts the data
+func TestPassphraseEmbedExtract(t *testing.T) {
+	t.Parallel()
+
+	fractal := NewFractalStego()
+	cover := createTestImage(160, 120)
+	data := []byte("keyed by a passphrase")
+
+	config := Config{Params: Params{"passphrase": "correct horse battery staple"}}
+	capacity, err := fractal.Capacity(cover, config)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, capacity, int(minCoverage*160*120/8)/2)
+
+	stegoImg, err := fractal.Embed(cover, data, config)
+	require.NoError(t, err)
+
+	extracted, err := fractal.Extract(stegoImg, config)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+
+	wrong, err := fractal.Extract(stegoImg, Config{Params: Params{"passphrase": "correct horse battery stapler"}})
+	if err == nil {
+		assert.NotEqual(t, data, wrong)
+	}
+}
+
+// TestDeriveFractalKey tests that key derivation is deterministic and passphrase dependent
+func TestDeriveFractalKey(t *testing.T) {
+	t.Parallel()
+
+	a, err := deriveFractalKey("alpha")
+	require.NoError(t, err)
+	fractalKeys.delete(sha256.Sum256([]byte("alpha")))
+	again, err := deriveFractalKey("alpha")
+	require.NoError(t, err)
+	assert.Equal(t, *a, *again)
+
+	b, err := deriveFractalKey("beta")
+	require.NoError(t, err)
+	assert.NotEqual(t, a.seed, b.seed)
+}
+
+// TestDerivedCacheBounded tests that the cache of derived secrets keeps only the most recently used ones
+func TestDerivedCacheBounded(t *testing.T) {
+	t.Parallel()
+
+	cache := newDerivedCache[int]()
+	for i := range derivedCacheSize + 2 {
+		cache.add(sha256.Sum256([]byte{byte(i)}), i)
+	}
+	assert.Equal(t, derivedCacheSize, cache.lru.Len())
+	assert.Len(t, cache.entries, derivedCacheSize)
+
+	_, ok := cache.get(sha256.Sum256([]byte{0}))
+	assert.False(t, ok, "the oldest entry must be evicted")
+	value, ok := cache.get(sha256.Sum256([]byte{derivedCacheSize + 1}))
+	assert.True(t, ok)
+	assert.Equal(t, derivedCacheSize+1, value)
+}
@@ -0,0 +1,152 @@
+package stego
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// payloadMagic marks data wrapped into a payload header
+const payloadMagic = "STGP"
+
+// payloadVersion is the current version of the payload header layout
+const payloadVersion = 1
+
+// PayloadHeaderSize is the number of bytes the header adds in front of the body
+const PayloadHeaderSize = len(payloadMagic) + 1 + 1 + 8 + 2 + 2 + 4 + 4
+
+// ErrNoPayloadHeader is returned when extracted data does not start with a payload header,
+// which is the case for images created before the header was introduced
+var ErrNoPayloadHeader = errors.New("payload header not found")
+
+// PayloadHeader describes the body that follows it inside the embedded data
+type PayloadHeader struct {
+	// Version is the header layout version
+	Version uint8
+	// Flags holds payload options such as FlagShamirShare
+	Flags uint8
+	// SetID identifies the images that carry pieces of the same payload
+	SetID [8]byte
+	// Seq is the zero-based index of this piece
+	Seq uint16
+	// Total is the number of pieces the payload was split into
+	Total uint16
+	// Length is the size of the body in bytes
+	Length uint32
+	// Checksum is the CRC-32 (IEEE) of the body
+	Checksum uint32
+}
+
+// NewSetID returns a random identifier for a set of payload pieces
+func NewSetID() ([8]byte, error) {
+	var id [8]byte
+	_, err := rand.Read(id[:])
+	return id, err
+}
+
+// appendHeader appends the header to out with the version, length and checksum filled in
+func appendHeader(out []byte, header PayloadHeader, length int, checksum uint32) []byte {
+	header.Version = payloadVersion
+	header.Length = uint32(length)
+	header.Checksum = checksum
+
+	out = append(out, payloadMagic...)
+	out = append(out, header.Version, header.Flags)
+	out = append(out, header.SetID[:]...)
+	out = binary.BigEndian.AppendUint16(out, header.Seq)
+	out = binary.BigEndian.AppendUint16(out, header.Total)
+	out = binary.BigEndian.AppendUint32(out, header.Length)
+	return binary.BigEndian.AppendUint32(out, header.Checksum)
+}
+
+// EncodePayload prepends the header to body, filling in the version, length and checksum
+func EncodePayload(header PayloadHeader, body []byte) []byte {
+	out := make([]byte, 0, PayloadHeaderSize+len(body))
+	out = appendHeader(out, header, len(body), crc32.ChecksumIEEE(body))
+	return append(out, body...)
+}
+
+// DecodePayload parses the header in front of data and verifies the body checksum
+func DecodePayload(data []byte) (PayloadHeader, []byte, error) {
+	header, err := decodeHeader(data)
+	if err != nil {
+		return header, nil, err
+	}
+	body := data[PayloadHeaderSize:]
+	if uint64(header.Length) > uint64(len(body)) {
+		return header, nil, errors.New("payload is truncated")
+	}
+	body = body[:header.Length]
+	if crc32.ChecksumIEEE(body) != header.Checksum {
+		return header, nil, errors.New("payload checksum mismatch")
+	}
+
+	return header, body, nil
+}
+
+// decodeHeader parses and checks the header at the start of data
+func decodeHeader(data []byte) (PayloadHeader, error) {
+	var header PayloadHeader
+	if len(data) < PayloadHeaderSize || string(data[:len(payloadMagic)]) != payloadMagic {
+		return header, ErrNoPayloadHeader
+	}
+
+	rest := data[len(payloadMagic):]
+	header.Version = rest[0]
+	header.Flags = rest[1]
+	copy(header.SetID[:], rest[2:10])
+	header.Seq = binary.BigEndian.Uint16(rest[10:12])
+	header.Total = binary.BigEndian.Uint16(rest[12:14])
+	header.Length = binary.BigEndian.Uint32(rest[14:18])
+	header.Checksum = binary.BigEndian.Uint32(rest[18:22])
+
+	if header.Version != payloadVersion {
+		return header, fmt.Errorf("unsupported payload version: %d", header.Version)
+	}
+	if header.Total == 0 || header.Seq >= header.Total {
+		return header, fmt.Errorf("invalid piece number %d of %d", header.Seq+1, header.Total)
+	}
+	return header, nil
+}
+
+// SealPayload wraps data into a header describing a single, unsplit payload
+func SealPayload(data []byte) ([]byte, error) {
+	setID, err := NewSetID()
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodePayload(PayloadHeader{SetID: setID, Total: 1}, data), nil
+}
+
+// OpenPayload unwraps a single payload produced by SealPayload.
+// Data without a header is returned unchanged so older images keep working.
+func OpenPayload(data []byte) ([]byte, error) {
+	header, body, err := DecodePayload(data)
+	if errors.Is(err, ErrNoPayloadHeader) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWhole(header); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// checkWhole returns an error when the header describes one of several pieces or shares
+func checkWhole(header PayloadHeader) error {
+	if header.Flags&FlagShamirShare != 0 {
+		return fmt.Errorf("image holds share %d of %d of a payload, join enough shares to extract it",
+			header.Seq+1, header.Total)
+	}
+	if header.Total > 1 {
+		return fmt.Errorf("image holds piece %d of %d of a split payload, join all pieces to extract it",
+			header.Seq+1, header.Total)
+	}
+	return nil
+}
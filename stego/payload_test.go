@@ -0,0 +1,56 @@
+package stego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPayloadRoundTrip tests that a sealed payload opens to the original data
+func TestPayloadRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("payload with a header")
+
+	sealed, err := SealPayload(data)
+	require.NoError(t, err)
+	assert.Len(t, sealed, PayloadHeaderSize+len(data))
+
+	opened, err := OpenPayload(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, data, opened)
+}
+
+// TestPayloadLegacy tests that data without a header is passed through unchanged
+func TestPayloadLegacy(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("raw data from an old image")
+
+	opened, err := OpenPayload(data)
+	require.NoError(t, err)
+	assert.Equal(t, data, opened)
+}
+
+// TestPayloadChecksum tests that a corrupted body is detected
+func TestPayloadChecksum(t *testing.T) {
+	t.Parallel()
+
+	sealed, err := SealPayload([]byte("payload with a header"))
+	require.NoError(t, err)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = OpenPayload(sealed)
+	assert.Error(t, err)
+}
+
+// TestPayloadPieceRejected tests that a piece of a split payload is not opened on its own
+func TestPayloadPieceRejected(t *testing.T) {
+	t.Parallel()
+
+	piece := EncodePayload(PayloadHeader{Seq: 1, Total: 3}, []byte("piece"))
+
+	_, err := OpenPayload(piece)
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package stego
+
+import (
+	"image"
+	"image/color"
+)
+
+// RGBAReader returns a function reading the pixel at x, y as color.RGBA. It gives the same
+// result as color.RGBAModel.Convert(img.At(x, y)), but reads the Pix slices of the common
+// image types directly instead of boxing every pixel into a color.Color interface.
+func RGBAReader(img image.Image) func(x, y int) color.RGBA {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return func(x, y int) color.RGBA {
+			i := img.PixOffset(x, y)
+			s := img.Pix[i : i+4 : i+4]
+			return color.RGBA{R: s[0], G: s[1], B: s[2], A: s[3]}
+		}
+
+	case *image.NRGBA:
+		return func(x, y int) color.RGBA {
+			i := img.PixOffset(x, y)
+			s := img.Pix[i : i+4 : i+4]
+			return toRGBA(color.NRGBA{R: s[0], G: s[1], B: s[2], A: s[3]})
+		}
+
+	case *image.Gray:
+		return func(x, y int) color.RGBA {
+			v := img.Pix[img.PixOffset(x, y)]
+			return color.RGBA{R: v, G: v, B: v, A: 0xFF}
+		}
+
+	case *image.Paletted:
+		// Convert the palette once; indices beyond it read as transparent black, and entries
+		// beyond 256 cannot be reached by a byte index
+		palette := make([]color.RGBA, 256)
+		for i, c := range img.Palette[:min(len(img.Palette), len(palette))] {
+			palette[i] = color.RGBAModel.Convert(c).(color.RGBA)
+		}
+		return func(x, y int) color.RGBA {
+			return palette[img.Pix[img.PixOffset(x, y)]]
+		}
+
+	case *image.YCbCr:
+		return func(x, y int) color.RGBA {
+			yi, ci := img.YOffset(x, y), img.COffset(x, y)
+			return toRGBA(color.YCbCr{Y: img.Y[yi], Cb: img.Cb[ci], Cr: img.Cr[ci]})
+		}
+
+	default:
+		return func(x, y int) color.RGBA {
+			return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+		}
+	}
+}
+
+// toRGBA converts a color the way color.RGBAModel does, without an interface conversion
+func toRGBA[C interface{ RGBA() (r, g, b, a uint32) }](c C) color.RGBA {
+	r, g, b, a := c.RGBA()
+	return color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+}
@@ -0,0 +1,107 @@
+package stego
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testImages returns one image of every type with a fast path, plus one without,
+// filled with random pixels and placed at a non-zero origin
+func testImages(width, height int) map[string]image.Image {
+	r := image.Rect(3, 5, 3+width, 5+height)
+	rnd := rand.New(rand.NewSource(1))
+	fill := func(pix []byte) {
+		for i := range pix {
+			pix[i] = byte(rnd.Intn(256))
+		}
+	}
+
+	rgba := image.NewRGBA(r)
+	fill(rgba.Pix)
+	// Keep the premultiplied colors valid
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		for j := range 3 {
+			rgba.Pix[i+j] = min(rgba.Pix[i+j], rgba.Pix[i+3])
+		}
+	}
+	nrgba := image.NewNRGBA(r)
+	fill(nrgba.Pix)
+	gray := image.NewGray(r)
+	fill(gray.Pix)
+	paletted := image.NewPaletted(r, palette.Plan9[:200])
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(rnd.Intn(len(paletted.Palette)))
+	}
+	// A palette longer than a byte can index must not overflow the converted one
+	long := image.NewPaletted(r, append(append(color.Palette(nil), palette.Plan9...), palette.WebSafe...))
+	fill(long.Pix)
+	ycbcr := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+	fill(ycbcr.Y)
+	fill(ycbcr.Cb)
+	fill(ycbcr.Cr)
+	gray16 := image.NewGray16(r)
+	fill(gray16.Pix)
+
+	return map[string]image.Image{
+		"RGBA":        rgba,
+		"NRGBA":       nrgba,
+		"Gray":        gray,
+		"Paletted":    paletted,
+		"LongPalette": long,
+		"YCbCr":       ycbcr,
+		"Gray16":      gray16,
+	}
+}
+
+// TestRGBAReader tests that the fast paths read exactly what the color model conversion does
+func TestRGBAReader(t *testing.T) {
+	t.Parallel()
+
+	for name, img := range testImages(37, 23) {
+		at := RGBAReader(img)
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				if !assert.Equal(t, want, at(x, y), "%s at %d,%d", name, x, y) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkPixelAccess compares reading every pixel of a 3-megapixel image
+// through At and the color model with the fast paths
+func BenchmarkPixelAccess(b *testing.B) {
+	for name, img := range testImages(2000, 1500) {
+		bounds := img.Bounds()
+
+		b.Run(name+"/At", func(b *testing.B) {
+			for range b.N {
+				var sum uint32
+				for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+					for x := bounds.Min.X; x < bounds.Max.X; x++ {
+						sum += uint32(color.RGBAModel.Convert(img.At(x, y)).(color.RGBA).B)
+					}
+				}
+			}
+		})
+		b.Run(name+"/RGBAReader", func(b *testing.B) {
+			for range b.N {
+				at := RGBAReader(img)
+				var sum uint32
+				for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+					for x := bounds.Min.X; x < bounds.Max.X; x++ {
+						sum += uint32(at(x, y).B)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package stego
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ProfileVersion is the current version of the profile file layout
+const ProfileVersion = 1
+
+// Embedding modes stored in a profile
+const (
+	ModeSingle   = "single"
+	ModeSplit    = "split"
+	ModeShare    = "share"
+	ModeDeniable = "deniable"
+)
+
+// Encryption modes stored in a profile
+const (
+	EncryptionNone       = "none"
+	EncryptionPassword   = "password"
+	EncryptionRecipients = "recipients"
+)
+
+// Profile formats, chosen by the file extension
+const (
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// Profile is a named, shareable set of embedding settings.
+// Secrets such as passwords are never stored, key files are referenced by path.
+type Profile struct {
+	// Version is the profile layout version, ProfileVersion when written
+	Version int `json:"version" toml:"version"`
+	// Name identifies the profile
+	Name string `json:"name" toml:"name"`
+	// Algorithm is the ID of the registered algorithm
+	Algorithm string `json:"algorithm" toml:"algorithm"`
+	// Params holds the algorithm parameters except the secret ones
+	Params Params `json:"params,omitempty" toml:"params,omitempty"`
+	// EmbeddingRate is the proportion of available cover elements to use
+	EmbeddingRate float64 `json:"embedding_rate" toml:"embedding_rate"`
+	// Region is the rectangle carrying the data as "x0,y0,x1,y1", empty for the whole image
+	Region string `json:"region,omitempty" toml:"region,omitempty"`
+	// Mode is the way the payload is laid out over the covers, one of the Mode constants
+	Mode string `json:"mode,omitempty" toml:"mode,omitempty"`
+	// ShareThreshold is the number of shares needed to recover the payload in ModeShare
+	ShareThreshold int `json:"share_threshold,omitempty" toml:"share_threshold,omitzero"`
+	// Encryption is one of the Encryption constants
+	Encryption string `json:"encryption,omitempty" toml:"encryption,omitempty"`
+	// Recipients lists X25519 public key files for EncryptionRecipients
+	Recipients []string `json:"recipients,omitempty" toml:"recipients,omitempty"`
+	// SigningKey is the Ed25519 private key file used to sign payloads
+	SigningKey string `json:"signing_key,omitempty" toml:"signing_key,omitempty"`
+	// Keyring is the file or directory of trusted signer keys used on extraction
+	Keyring string `json:"keyring,omitempty" toml:"keyring,omitempty"`
+}
+
+// NewProfile creates a profile for the algorithm with the given ID or display name and config
+func NewProfile(name, algorithm string, config Config) (*Profile, error) {
+	info, ok := Lookup(algorithm)
+	if !ok {
+		return nil, fmt.Errorf("unknown steganography algorithm: %s", algorithm)
+	}
+
+	return &Profile{
+		Version:       ProfileVersion,
+		Name:          name,
+		Algorithm:     info.ID,
+		Params:        config.Params,
+		EmbeddingRate: config.EmbeddingRate,
+		Region:        FormatRegion(config.Region),
+		Mode:          ModeSingle,
+		Encryption:    EncryptionNone,
+	}, nil
+}
+
+// Validate checks the profile and normalizes its parameters against the algorithm schema
+func (p *Profile) Validate() error {
+	switch {
+	case p.Version == 0:
+		return errors.New("profile version is missing")
+	case p.Version > ProfileVersion:
+		return fmt.Errorf("profile version %d is newer than the supported version %d", p.Version, ProfileVersion)
+	}
+
+	info, ok := Lookup(p.Algorithm)
+	if !ok {
+		return fmt.Errorf("unknown steganography algorithm: %s", p.Algorithm)
+	}
+	p.Algorithm = info.ID
+
+	params, err := info.Schema.Resolve(p.Params)
+	if err != nil {
+		return err
+	}
+	p.Params = info.Schema.Public(params)
+
+	if p.EmbeddingRate < 0 || p.EmbeddingRate > 1 {
+		return fmt.Errorf("invalid embedding rate: %v", p.EmbeddingRate)
+	}
+
+	region, err := ParseRegion(p.Region)
+	if err != nil {
+		return err
+	}
+	p.Region = FormatRegion(region)
+
+	switch p.Mode {
+	case "":
+		p.Mode = ModeSingle
+	case ModeSingle, ModeSplit, ModeDeniable:
+	case ModeShare:
+		// One share is enough to recover the payload, as ShareSecret allows
+		if p.ShareThreshold < 1 {
+			return fmt.Errorf("invalid share threshold: %d", p.ShareThreshold)
+		}
+	default:
+		return fmt.Errorf("unknown embedding mode: %s", p.Mode)
+	}
+
+	switch p.Encryption {
+	case "":
+		p.Encryption = EncryptionNone
+	case EncryptionNone, EncryptionPassword:
+	case EncryptionRecipients:
+		if len(p.Recipients) == 0 {
+			return errors.New("recipient encryption requires at least one recipient key")
+		}
+	default:
+		return fmt.Errorf("unknown encryption mode: %s", p.Encryption)
+	}
+
+	return nil
+}
+
+// Config returns the steganography config described by the profile.
+// The region is expected to have been checked by Validate.
+func (p *Profile) Config() Config {
+	region, _ := ParseRegion(p.Region)
+	return Config{
+		EmbeddingRate: p.EmbeddingRate,
+		Params:        p.Params,
+		Region:        region,
+	}
+}
+
+// ProfileFormat returns the profile format for a file name
+func ProfileFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return FormatJSON, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("unsupported profile format %q, use .json or .toml", ext)
+	}
+}
+
+// MarshalProfile validates the profile and encodes it in the given format
+func MarshalProfile(p *Profile, format string) ([]byte, error) {
+	p.Version = ProfileVersion
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(p); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported profile format: %s", format)
+	}
+}
+
+// UnmarshalProfile decodes and validates a profile in the given format
+func UnmarshalProfile(data []byte, format string) (*Profile, error) {
+	var p Profile
+
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if _, err := toml.Decode(string(data), &p); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported profile format: %s", format)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SaveProfile writes the profile to a .json or .toml file
+func SaveProfile(path string, p *Profile) error {
+	format, err := ProfileFormat(path)
+	if err != nil {
+		return err
+	}
+	data, err := MarshalProfile(p, format)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadProfile reads a profile from a .json or .toml file
+func LoadProfile(path string) (*Profile, error) {
+	format, err := ProfileFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := UnmarshalProfile(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
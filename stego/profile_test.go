@@ -0,0 +1,70 @@
+package stego
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProfileRoundTrip tests that profiles survive both file formats
+func TestProfileRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		EmbeddingRate: 0.3,
+		Params:        FractalParams{Type: "Julia", Iterations: 250, Threshold: 4, Passphrase: "secret"}.Params(),
+	}
+	profile, err := NewProfile("team", "Фрактал", config)
+	require.NoError(t, err)
+	profile.Mode = ModeShare
+	profile.ShareThreshold = 3
+	profile.Encryption = EncryptionRecipients
+	profile.Recipients = []string{"alice.pub", "bob.pub"}
+
+	dir := t.TempDir()
+	for _, name := range []string{"team.json", "team.toml"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, SaveProfile(path, profile))
+
+		loaded, err := LoadProfile(path)
+		require.NoError(t, err)
+		assert.Equal(t, profile, loaded)
+		assert.Equal(t, fractalSchema.Public(config.Params), loaded.Config().Params)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "secret")
+	}
+
+	assert.Error(t, SaveProfile(filepath.Join(dir, "team.yaml"), profile))
+}
+
+// TestProfileVersion tests that profiles from a newer or unknown layout are rejected
+func TestProfileVersion(t *testing.T) {
+	t.Parallel()
+
+	_, err := UnmarshalProfile([]byte(`{"version": 2, "algorithm": "fractal"}`), FormatJSON)
+	assert.ErrorContains(t, err, "newer")
+
+	_, err = UnmarshalProfile([]byte(`{"algorithm": "fractal"}`), FormatJSON)
+	assert.Error(t, err)
+
+	p, err := UnmarshalProfile([]byte("version = 1\nalgorithm = \"fractal\"\n[params]\niterations = 70\n"), FormatTOML)
+	require.NoError(t, err)
+	assert.Equal(t, 70, p.Params.Int("iterations"))
+	assert.Equal(t, "Mandelbrot", p.Params.String("type"))
+	assert.Equal(t, ModeSingle, p.Mode)
+
+	_, err = UnmarshalProfile([]byte(`{"version": 1, "algorithm": "fractal", "params": {"iterations": -1}}`), FormatJSON)
+	assert.Error(t, err)
+
+	p, err = UnmarshalProfile([]byte(`{"version": 1, "algorithm": "fractal", "mode": "share", "share_threshold": 1}`), FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.ShareThreshold)
+
+	_, err = UnmarshalProfile([]byte(`{"version": 1, "algorithm": "fractal", "mode": "share"}`), FormatJSON)
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package stego
+
+import (
+	"context"
+	"image"
+	"sync"
+)
+
+// Progress receives the progress of a long-running operation
+type Progress interface {
+	// Report is called with the completed share of the work, from 0 to 1.
+	// Calls may come from worker goroutines but never overlap.
+	Report(done float64)
+}
+
+// ProgressFunc adapts an ordinary function to the Progress interface
+type ProgressFunc func(done float64)
+
+// Report calls f(done)
+func (f ProgressFunc) Report(done float64) {
+	f(done)
+}
+
+// EmbedContext embeds data with the algorithm, stopping when ctx is done.
+// Algorithms without a context-aware variant are only checked before they start
+// and report their progress at the end.
+func EmbedContext(ctx context.Context, s Steganographer, cover image.Image, data []byte, config Config, progress Progress) (image.Image, error) {
+	if cs, ok := s.(ContextSteganographer); ok {
+		return cs.EmbedContext(ctx, cover, data, config, progress)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stego, err := s.Embed(cover, data, config)
+	if err == nil && progress != nil {
+		progress.Report(1)
+	}
+	return stego, err
+}
+
+// ExtractContext extracts data with the algorithm, stopping when ctx is done.
+// Algorithms without a context-aware variant are only checked before they start
+// and report their progress at the end.
+func ExtractContext(ctx context.Context, s Steganographer, stego image.Image, config Config, progress Progress) ([]byte, error) {
+	if cs, ok := s.(ContextSteganographer); ok {
+		return cs.ExtractContext(ctx, stego, config, progress)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := s.Extract(stego, config)
+	if err == nil && progress != nil {
+		progress.Report(1)
+	}
+	return data, err
+}
+
+// progressStage maps the steps of one stage of an operation onto its share [from, to]
+// of the whole. It is safe for concurrent use, forwards changes of at least one percent
+// and does nothing when it is nil.
+type progressStage struct {
+	mu       sync.Mutex
+	progress Progress
+	from, to float64
+	total    int
+	done     int
+	reported float64
+}
+
+// newProgressStage returns a stage of total steps, or nil when there is no progress to report to
+func newProgressStage(progress Progress, from, to float64, total int) *progressStage {
+	if progress == nil {
+		return nil
+	}
+	return &progressStage{progress: progress, from: from, to: to, total: total, reported: -1}
+}
+
+// add marks n more steps of the stage as done
+func (s *progressStage) add(n int) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.done = min(s.done+n, s.total)
+	share := s.to
+	if s.total > 0 {
+		share = s.from + (s.to-s.from)*float64(s.done)/float64(s.total)
+	}
+	if share-s.reported >= 0.01 || (s.done == s.total && share > s.reported) {
+		s.reported = share
+		s.progress.Report(share)
+	}
+}
+
+// finish marks the whole stage as done, for stages skipped by a cache hit
+func (s *progressStage) finish() {
+	if s == nil {
+		return
+	}
+	s.add(s.total)
+}
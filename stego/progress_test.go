@@ -0,0 +1,131 @@
+package stego
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordProgress returns a Progress that appends every report to the returned slice
+func recordProgress() (Progress, *[]float64) {
+	var mu sync.Mutex
+	reports := []float64{}
+	return ProgressFunc(func(done float64) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, done)
+	}), &reports
+}
+
+// TestContextProgress tests that embedding and extraction report increasing progress up to 1
+func TestContextProgress(t *testing.T) {
+	t.Parallel()
+
+	cover := createTestImage(211, 157)
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 77, Threshold: 2}.Params()}
+	data := []byte("progress is reported")
+
+	progress, reports := recordProgress()
+	stegoImage, err := EmbedContext(context.Background(), NewFractalStego(), cover, data, config, progress)
+	require.NoError(t, err)
+	assert.IsNonDecreasing(t, *reports)
+	assert.Equal(t, 1.0, (*reports)[len(*reports)-1])
+
+	progress, reports = recordProgress()
+	extracted, err := ExtractContext(context.Background(), NewFractalStego(), stegoImage, config, progress)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+	assert.IsNonDecreasing(t, *reports)
+	assert.Equal(t, 1.0, (*reports)[len(*reports)-1])
+}
+
+// TestContextCancelled tests that a cancelled context stops the operation and leaves no mask cached
+func TestContextCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cover := createTestImage(223, 163)
+	params := FractalParams{Type: "Julia", Iterations: 91, Threshold: 2}
+	config := Config{EmbeddingRate: 1, Params: params.Params()}
+
+	_, err := NewFractalStego().EmbedContext(ctx, cover, []byte("data"), config, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = NewFractalStego().ExtractContext(ctx, cover, config, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	key := maskKey{width: 223, height: 163, fractalType: params.Type, iterations: params.Iterations, threshold: params.Threshold}
+	masks.mu.Lock()
+	_, cached := masks.entries[key]
+	masks.mu.Unlock()
+	assert.False(t, cached)
+}
+
+// TestParallelRowsCancelled tests that no more bands start once the context is cancelled
+func TestParallelRowsCancelled(t *testing.T) {
+	t.Parallel()
+
+	for _, workers := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var mu sync.Mutex
+		bands := 0
+		err := parallelRowsN(ctx, 100*rowBand, workers, func(y0, y1 int) {
+			mu.Lock()
+			defer mu.Unlock()
+			bands++
+			cancel()
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.LessOrEqual(t, bands, workers, "%d workers", workers)
+	}
+}
+
+// plainStego is an algorithm without context support
+type plainStego struct {
+	fractal  FractalStego
+	embedded bool
+}
+
+func (p *plainStego) Embed(cover image.Image, data []byte, config Config) (image.Image, error) {
+	p.embedded = true
+	return p.fractal.Embed(cover, data, config)
+}
+
+func (p *plainStego) Extract(stego image.Image, config Config) ([]byte, error) {
+	return p.fractal.Extract(stego, config)
+}
+
+func (p *plainStego) Capacity(cover image.Image, config Config) (int, error) {
+	return p.fractal.Capacity(cover, config)
+}
+
+func (p *plainStego) Name() string {
+	return "plain"
+}
+
+// TestContextFallback tests the context helpers on an algorithm that only implements Steganographer
+func TestContextFallback(t *testing.T) {
+	t.Parallel()
+
+	var s Steganographer = &plainStego{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cover := createTestImage(64, 64)
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+
+	_, err := EmbedContext(ctx, s, cover, []byte("x"), config, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, s.(*plainStego).embedded)
+
+	progress, reports := recordProgress()
+	_, err = EmbedContext(context.Background(), s, cover, []byte("x"), config, progress)
+	require.NoError(t, err)
+	assert.True(t, s.(*plainStego).embedded)
+	assert.Equal(t, []float64{1}, *reports)
+}
@@ -0,0 +1,78 @@
+package stego
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// ParseRegion reads a region of interest written as "x0,y0,x1,y1".
+// Empty text is the empty rectangle, which stands for the whole image.
+func ParseRegion(text string) (image.Rectangle, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return image.Rectangle{}, nil
+	}
+
+	fields := strings.Split(text, ",")
+	if len(fields) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid region %q, expected x0,y0,x1,y1", text)
+	}
+	var coords [4]int
+	for i, field := range fields {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || v < 0 {
+			return image.Rectangle{}, fmt.Errorf("invalid region %q, coordinates must be non-negative integers", text)
+		}
+		coords[i] = v
+	}
+
+	r := image.Rect(coords[0], coords[1], coords[2], coords[3])
+	if r.Empty() {
+		return image.Rectangle{}, fmt.Errorf("invalid region %q, it has no pixels", text)
+	}
+	return r, nil
+}
+
+// FormatRegion writes a region the way ParseRegion reads it, the empty rectangle as empty text
+func FormatRegion(r image.Rectangle) string {
+	if r.Empty() {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+}
+
+// embeddingArea returns the rectangle of an image with the given bounds that carries data:
+// the region moved to the image origin, or the whole image when the region is empty
+func embeddingArea(bounds, region image.Rectangle) (image.Rectangle, error) {
+	if region.Empty() {
+		return bounds, nil
+	}
+
+	area := region.Add(bounds.Min)
+	if !area.In(bounds) {
+		return image.Rectangle{}, fmt.Errorf("region %s lies outside the %dx%d image",
+			FormatRegion(region), bounds.Dx(), bounds.Dy())
+	}
+	return area, nil
+}
+
+// CropRegion returns the part of the image inside the region, so that code working on
+// whole images, such as Detect, sees exactly the pixels that carry the data
+func CropRegion(img image.Image, region image.Rectangle) (image.Image, error) {
+	area, err := embeddingArea(img.Bounds(), region)
+	if err != nil || area == img.Bounds() {
+		return img, err
+	}
+
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(area), nil
+	}
+	cropped := image.NewRGBA(area)
+	draw.Draw(cropped, area, img, area.Min, draw.Src)
+	return cropped, nil
+}
@@ -0,0 +1,132 @@
+package stego
+
+import (
+	"image"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRegion tests parsing and formatting of regions of interest
+func TestParseRegion(t *testing.T) {
+	t.Parallel()
+
+	r, err := ParseRegion(" 10, 20,110 ,100 ")
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(10, 20, 110, 100), r)
+	assert.Equal(t, "10,20,110,100", FormatRegion(r))
+
+	r, err = ParseRegion("")
+	require.NoError(t, err)
+	assert.True(t, r.Empty())
+	assert.Empty(t, FormatRegion(r))
+
+	for _, text := range []string{"1,2,3", "a,b,c,d", "-1,0,5,5", "5,5,5,9"} {
+		_, err := ParseRegion(text)
+		assert.Error(t, err, text)
+	}
+}
+
+// rebase copies an image so that its bounds start at the origin, as saving and loading does
+func rebase(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	return out
+}
+
+// TestEmbedSubImage tests embedding into an image whose bounds do not start at the origin
+func TestEmbedSubImage(t *testing.T) {
+	t.Parallel()
+
+	s := NewFractalStego()
+	full := createTestImage(300, 200).(*image.RGBA)
+	sub := full.SubImage(image.Rect(37, 21, 237, 171))
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+	data := []byte("sub-image payload")
+
+	stegoImage, err := s.Embed(sub, data, config)
+	require.NoError(t, err)
+	assert.Equal(t, sub.Bounds(), stegoImage.Bounds())
+
+	extracted, err := s.Extract(stegoImage, config)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+
+	extracted, err = s.Extract(rebase(stegoImage), config)
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+}
+
+// TestEmbedRegion tests that a region of interest confines the changes and is found again
+// relative to the image origin
+func TestEmbedRegion(t *testing.T) {
+	t.Parallel()
+
+	s := NewFractalStego()
+	full := createTestImage(300, 200).(*image.RGBA)
+	cover := full.SubImage(image.Rect(20, 10, 300, 200))
+	region := image.Rect(10, 20, 210, 170)
+	config := Config{
+		EmbeddingRate: 1,
+		Params:        FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params(),
+		Region:        region,
+	}
+	data := []byte("region payload")
+
+	stegoImage, err := s.Embed(cover, data, config)
+	require.NoError(t, err)
+
+	// Nothing outside the region changes
+	area := region.Add(cover.Bounds().Min)
+	stegoRGBA := stegoImage.(*image.RGBA)
+	b := cover.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !image.Pt(x, y).In(area) && stegoRGBA.RGBAAt(x, y) != full.RGBAAt(x, y) {
+				t.Fatalf("pixel %d,%d outside the region changed", x, y)
+			}
+		}
+	}
+
+	for _, img := range []image.Image{stegoImage, rebase(stegoImage)} {
+		extracted, err := s.Extract(img, config)
+		require.NoError(t, err)
+		assert.Equal(t, data, extracted)
+	}
+
+	// The cropped region holds the data as a whole image
+	cropped, err := CropRegion(stegoImage, region)
+	require.NoError(t, err)
+	extracted, err := s.Extract(cropped, Config{EmbeddingRate: 1, Params: config.Params})
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+
+	config.Region = image.Rect(100, 100, 400, 150)
+	_, err = s.Embed(cover, data, config)
+	assert.ErrorContains(t, err, "outside")
+}
+
+// TestProfileRegion tests that profiles carry the region of interest
+func TestProfileRegion(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		EmbeddingRate: 0.5,
+		Params:        FractalParams{Type: "Julia", Iterations: 50, Threshold: 2}.Params(),
+		Region:        image.Rect(1, 2, 30, 40),
+	}
+	profile, err := NewProfile("roi", "fractal", config)
+	require.NoError(t, err)
+
+	data, err := MarshalProfile(profile, FormatTOML)
+	require.NoError(t, err)
+	loaded, err := UnmarshalProfile(data, FormatTOML)
+	require.NoError(t, err)
+	assert.Equal(t, config.Region, loaded.Config().Region)
+
+	loaded.Region = "1,2"
+	assert.Error(t, loaded.Validate())
+}
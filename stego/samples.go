@@ -0,0 +1,141 @@
+package stego
+
+import (
+	"image"
+	"image/draw"
+)
+
+// samplePlane addresses, in every pixel of an image, the byte holding the least significant
+// bit of the sample that carries data: blue for color images and the level for grayscale ones.
+// In 16-bit formats this is the low byte of the big-endian sample.
+type samplePlane struct {
+	pix    []byte
+	stride int
+	min    image.Point
+	// size is the number of bytes per pixel, sample the offset of the byte inside a pixel
+	size, sample int
+}
+
+// offset returns the index in pix of the data-carrying byte of the pixel at x, y
+func (p samplePlane) offset(x, y int) int {
+	return (y-p.min.Y)*p.stride + (x-p.min.X)*p.size + p.sample
+}
+
+// bit returns the data bit of the pixel at x, y
+func (p samplePlane) bit(x, y int) byte {
+	return p.pix[p.offset(x, y)] & 1
+}
+
+// setBit replaces the data bit of the pixel at x, y
+func (p samplePlane) setBit(x, y int, bit byte) {
+	i := p.offset(x, y)
+	p.pix[i] = p.pix[i]&0xFE | bit
+}
+
+// planeOf returns the sample plane of the image formats embedded in their own sample type
+func planeOf(img image.Image) (samplePlane, bool) {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return samplePlane{img.Pix, img.Stride, img.Rect.Min, 4, 2}, true
+	case *image.NRGBA:
+		return samplePlane{img.Pix, img.Stride, img.Rect.Min, 4, 2}, true
+	case *image.RGBA64:
+		return samplePlane{img.Pix, img.Stride, img.Rect.Min, 8, 5}, true
+	case *image.NRGBA64:
+		return samplePlane{img.Pix, img.Stride, img.Rect.Min, 8, 5}, true
+	case *image.Gray:
+		return samplePlane{img.Pix, img.Stride, img.Rect.Min, 1, 0}, true
+	case *image.Gray16:
+		return samplePlane{img.Pix, img.Stride, img.Rect.Min, 2, 1}, true
+	default:
+		return samplePlane{}, false
+	}
+}
+
+// cloneCover copies the cover into a new image of the same color model and depth and returns
+// the copy with its sample plane. Translucent premultiplied covers are copied into their
+// non-premultiplied counterpart, whose color samples survive PNG encoding unchanged, and
+// formats without a sample plane into NRGBA.
+func cloneCover(cover image.Image) (image.Image, samplePlane) {
+	b := cover.Bounds()
+
+	var out image.Image
+	same := true
+	switch cover := cover.(type) {
+	case *image.RGBA:
+		if cover.Opaque() {
+			out = image.NewRGBA(b)
+		} else {
+			out, same = image.NewNRGBA(b), false
+		}
+	case *image.RGBA64:
+		if cover.Opaque() {
+			out = image.NewRGBA64(b)
+		} else {
+			out, same = image.NewNRGBA64(b), false
+		}
+	case *image.NRGBA:
+		out = image.NewNRGBA(b)
+	case *image.NRGBA64:
+		out = image.NewNRGBA64(b)
+	case *image.Gray:
+		out = image.NewGray(b)
+	case *image.Gray16:
+		out = image.NewGray16(b)
+	default:
+		out, same = image.NewNRGBA(b), false
+	}
+	dst, _ := planeOf(out)
+
+	// Images cloned into their own format are copied row by row, the rest is converted
+	if src, ok := planeOf(cover); ok && same {
+		row := b.Dx() * src.size
+		for y := 0; y < b.Dy(); y++ {
+			copy(dst.pix[y*dst.stride:y*dst.stride+row], src.pix[y*src.stride:y*src.stride+row])
+		}
+	} else {
+		draw.Draw(out.(draw.Image), b, cover, b.Min, draw.Src)
+	}
+
+	return out, dst
+}
+
+// transparency returns a function reporting whether the pixel at x, y is fully transparent,
+// or nil when the image has no transparent pixels
+func transparency(img image.Image) func(x, y int) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return nil
+	}
+
+	switch img := img.(type) {
+	case *image.RGBA:
+		return func(x, y int) bool { return img.Pix[img.PixOffset(x, y)+3] == 0 }
+	case *image.NRGBA:
+		return func(x, y int) bool { return img.Pix[img.PixOffset(x, y)+3] == 0 }
+	case *image.RGBA64:
+		return func(x, y int) bool {
+			i := img.PixOffset(x, y)
+			return img.Pix[i+6]|img.Pix[i+7] == 0
+		}
+	case *image.NRGBA64:
+		return func(x, y int) bool {
+			i := img.PixOffset(x, y)
+			return img.Pix[i+6]|img.Pix[i+7] == 0
+		}
+	default:
+		at := RGBAReader(img)
+		return func(x, y int) bool { return at(x, y).A == 0 }
+	}
+}
+
+// lsbReader returns a function reading the data bit of the pixel at x, y: from the sample
+// plane for the formats that have one, otherwise from the blue channel of the 8-bit color
+func lsbReader(img image.Image) func(x, y int) byte {
+	if plane, ok := planeOf(img); ok {
+		return plane.bit
+	}
+	at := RGBAReader(img)
+	return func(x, y int) byte {
+		return at(x, y).B & 1
+	}
+}
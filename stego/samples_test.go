@@ -0,0 +1,95 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPreserveFormat tests that the stego image keeps the color model and depth of the cover,
+// changes only the lowest bit of the carrying sample and survives a PNG round trip
+func TestPreserveFormat(t *testing.T) {
+	t.Parallel()
+
+	r := image.Rect(0, 0, 160, 120)
+	rnd := rand.New(rand.NewSource(2))
+	// opaque fills pix with random samples and sets the trailing alpha samples of every pixel
+	opaque := func(pix []byte, size int) {
+		rnd.Read(pix)
+		for i := 0; i < len(pix); i += size {
+			for j := size * 3 / 4; j < size; j++ {
+				pix[i+j] = 0xFF
+			}
+		}
+	}
+
+	rgba, nrgba := image.NewRGBA(r), image.NewNRGBA(r)
+	opaque(rgba.Pix, 4)
+	opaque(nrgba.Pix, 4)
+	rgba64, nrgba64 := image.NewRGBA64(r), image.NewNRGBA64(r)
+	opaque(rgba64.Pix, 8)
+	opaque(nrgba64.Pix, 8)
+	gray, gray16 := image.NewGray(r), image.NewGray16(r)
+	rnd.Read(gray.Pix)
+	rnd.Read(gray16.Pix)
+	ycbcr := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+	rnd.Read(ycbcr.Y)
+
+	testCases := []struct {
+		cover image.Image
+		want  image.Image
+	}{
+		{rgba, &image.RGBA{}},
+		{nrgba, &image.NRGBA{}},
+		{rgba64, &image.RGBA64{}},
+		{nrgba64, &image.NRGBA64{}},
+		{gray, &image.Gray{}},
+		{gray16, &image.Gray16{}},
+		// Formats without a sample plane are embedded as NRGBA
+		{ycbcr, &image.NRGBA{}},
+	}
+
+	s := NewFractalStego()
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+	data := []byte("format-preserving payload")
+
+	for _, tc := range testCases {
+		name := reflect.TypeOf(tc.cover).String()
+
+		stegoImage, err := s.Embed(tc.cover, data, config)
+		require.NoError(t, err, name)
+		require.IsType(t, tc.want, stegoImage, name)
+
+		// Only the lowest bit of the carrying byte of a pixel may differ
+		if before, ok := planeOf(tc.cover); ok {
+			after, _ := planeOf(stegoImage)
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					i := before.offset(x, y) - before.sample
+					for k := range before.size {
+						diff := before.pix[i+k] ^ after.pix[i+k]
+						if diff > 1 || (diff == 1 && k != before.sample) {
+							t.Fatalf("%s: byte %d of pixel %d,%d changed from %#x to %#x",
+								name, k, x, y, before.pix[i+k], after.pix[i+k])
+						}
+					}
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, stegoImage))
+		decoded, err := png.Decode(&buf)
+		require.NoError(t, err)
+
+		extracted, err := s.Extract(decoded, config)
+		require.NoError(t, err, name)
+		assert.Equal(t, data, extracted, name)
+	}
+}
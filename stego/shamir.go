@@ -0,0 +1,215 @@
+package stego
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+)
+
+// FlagShamirShare marks a payload body that holds one Shamir share instead of a split piece
+const FlagShamirShare uint8 = 1 << 0
+
+// shareBodyPrefix is the threshold byte in front of every share
+const shareBodyPrefix = 1
+
+// shareChecksumSize is the size of the CRC-32 appended to the payload before it is shared.
+// The checksum is split along with the payload, so fewer than k shares reveal nothing of it.
+const shareChecksumSize = 4
+
+// InsufficientSharesError is returned when fewer shares than the threshold were supplied
+type InsufficientSharesError struct {
+	// Have is the number of distinct shares found
+	Have int
+	// Need is the threshold required to reconstruct the payload
+	Need int
+	// Total is the number of shares that were created
+	Total int
+}
+
+func (e *InsufficientSharesError) Error() string {
+	return fmt.Sprintf("found %d of %d shares, at least %d are required", e.Have, e.Total, e.Need)
+}
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(2^8) with generator 3
+var gfExp, gfLog = func() ([510]byte, [256]byte) {
+	var exp [510]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// multiply by the generator 3 modulo the AES polynomial
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// ShareSecret splits secret into n shares so that any k of them reconstruct it.
+// Share i is evaluated at x = i+1.
+func ShareSecret(secret []byte, n, k int) ([][]byte, error) {
+	if k < 1 || n < k || n > 255 {
+		return nil, fmt.Errorf("invalid threshold %d of %d", k, n)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+
+	coeffs := make([]byte, k)
+	for pos, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+
+		for i := range shares {
+			x := byte(i + 1)
+			// Horner's scheme
+			var y byte
+			for j := k - 1; j >= 0; j-- {
+				y = gfMul(y, x) ^ coeffs[j]
+			}
+			shares[i][pos] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// CombineShares reconstructs the secret from shares taken at the given x coordinates
+func CombineShares(xs []byte, shares [][]byte) ([]byte, error) {
+	if len(xs) == 0 || len(xs) != len(shares) {
+		return nil, errors.New("no shares to combine")
+	}
+
+	size := len(shares[0])
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shares have different lengths")
+		}
+		if xs[i] == 0 {
+			return nil, errors.New("invalid share coordinate")
+		}
+		for j := 0; j < i; j++ {
+			if xs[i] == xs[j] {
+				return nil, errors.New("duplicate share coordinate")
+			}
+		}
+	}
+
+	// Lagrange basis polynomials evaluated at zero
+	basis := make([]byte, len(xs))
+	for i, xi := range xs {
+		num, den := byte(1), byte(1)
+		for j, xj := range xs {
+			if i != j {
+				num = gfMul(num, xj)
+				den = gfMul(den, xi^xj)
+			}
+		}
+		basis[i] = gfDiv(num, den)
+	}
+
+	secret := make([]byte, size)
+	for pos := range secret {
+		var v byte
+		for i, share := range shares {
+			v ^= gfMul(share[pos], basis[i])
+		}
+		secret[pos] = v
+	}
+
+	return secret, nil
+}
+
+// Share embeds n = len(covers) Shamir shares of data so that any k images reconstruct it.
+// Every cover must be able to hold the whole payload and its checksum.
+func Share(alg Steganographer, covers []image.Image, data []byte, k int, config Config) ([]image.Image, error) {
+	secret := binary.BigEndian.AppendUint32(append([]byte(nil), data...), crc32.ChecksumIEEE(data))
+	shares, err := ShareSecret(secret, len(covers), k)
+	if err != nil {
+		return nil, err
+	}
+
+	setID, err := NewSetID()
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]image.Image, len(covers))
+	for i, cover := range covers {
+		body := make([]byte, 0, shareBodyPrefix+len(shares[i]))
+		body = append(body, byte(k))
+		body = append(body, shares[i]...)
+
+		header := PayloadHeader{Flags: FlagShamirShare, SetID: setID, Seq: uint16(i), Total: uint16(len(covers))}
+		img, err := alg.Embed(cover, EncodePayload(header, body), config)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %w", i+1, err)
+		}
+		images[i] = img
+	}
+
+	return images, nil
+}
+
+// combinePayloadShares reconstructs a payload from the share bodies indexed by sequence number
+func combinePayloadShares(bodies map[uint16][]byte, total int) ([]byte, error) {
+	var xs []byte
+	var shares [][]byte
+	threshold, size := 0, 0
+
+	for seq, body := range bodies {
+		if len(body) < shareBodyPrefix+shareChecksumSize {
+			return nil, fmt.Errorf("share %d is truncated", seq+1)
+		}
+		k := int(body[0])
+		if threshold == 0 {
+			threshold, size = k, len(body)
+		} else if k != threshold || len(body) != size {
+			return nil, fmt.Errorf("share %d belongs to a different payload", seq+1)
+		}
+
+		xs = append(xs, byte(seq+1))
+		shares = append(shares, body[shareBodyPrefix:])
+	}
+
+	if len(shares) < threshold {
+		return nil, &InsufficientSharesError{Have: len(shares), Need: threshold, Total: total}
+	}
+
+	secret, err := CombineShares(xs[:threshold], shares[:threshold])
+	if err != nil {
+		return nil, err
+	}
+	payload, checksum := secret[:len(secret)-shareChecksumSize], secret[len(secret)-shareChecksumSize:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(checksum) {
+		return nil, errors.New("reconstructed payload checksum mismatch")
+	}
+
+	return payload, nil
+}
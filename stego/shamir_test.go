@@ -0,0 +1,86 @@
+package stego
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShareSecretCombine tests that every k-subset of shares reconstructs the secret
+func TestShareSecretCombine(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("threshold secret sharing")
+	shares, err := ShareSecret(secret, 5, 3)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				xs := []byte{byte(a + 1), byte(b + 1), byte(c + 1)}
+				got, err := CombineShares(xs, [][]byte{shares[a], shares[b], shares[c]})
+				require.NoError(t, err)
+				assert.Equal(t, secret, got)
+			}
+		}
+	}
+
+	got, err := CombineShares([]byte{1, 2}, [][]byte{shares[0], shares[1]})
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, got)
+}
+
+// TestShareJoin tests embedding shares and joining any k images in any order
+func TestShareJoin(t *testing.T) {
+	t.Parallel()
+
+	stego := NewFractalStego()
+	config := splitTestConfig()
+	covers := []image.Image{
+		createTestImage(100, 100),
+		createTestImage(100, 100),
+		createTestImage(100, 100),
+		createTestImage(100, 100),
+	}
+	data := []byte("any two of four images reveal this")
+
+	images, err := Share(stego, covers, data, 2, config)
+	require.NoError(t, err)
+
+	joined, err := Join(stego, []image.Image{images[3], images[1]}, config)
+	require.NoError(t, err)
+	assert.Equal(t, data, joined)
+
+	_, err = Join(stego, []image.Image{images[2]}, config)
+	var sharesErr *InsufficientSharesError
+	require.ErrorAs(t, err, &sharesErr)
+	assert.Equal(t, 2, sharesErr.Need)
+	assert.Equal(t, 1, sharesErr.Have)
+
+	raw, err := stego.Extract(images[0], config)
+	require.NoError(t, err)
+	_, err = OpenPayload(raw)
+	assert.Error(t, err)
+
+	// A single share must not carry the checksum of the payload in the clear
+	_, body, err := DecodePayload(raw)
+	require.NoError(t, err)
+	checksum := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+	assert.NotContains(t, string(body), string(checksum))
+	assert.Len(t, body, shareBodyPrefix+len(data)+shareChecksumSize)
+}
+
+// TestShareInvalidThreshold tests that impossible thresholds are rejected
+func TestShareInvalidThreshold(t *testing.T) {
+	t.Parallel()
+
+	_, err := ShareSecret([]byte("x"), 2, 3)
+	assert.Error(t, err)
+	_, err = ShareSecret([]byte("x"), 2, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,277 @@
+package stego
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// signedMagic marks payloads wrapped into a signature envelope.
+//
+// The signer fingerprint lives in this envelope rather than in PayloadHeader: the signature
+// is made over the whole payload before it is sealed, split into pieces or shared, and every
+// piece then gets a PayloadHeader of its own. A fingerprint in that header would sit outside
+// the signed bytes, be repeated in each piece and be lost once Join reassembles the payload,
+// while the envelope travels with the data and is verified after joining.
+const signedMagic = "STGSIG1\x00"
+
+// FingerprintSize is the length of a signer fingerprint in bytes
+const FingerprintSize = 16
+
+// signedHeaderSize is the magic, the signer fingerprint and the signature
+const signedHeaderSize = len(signedMagic) + FingerprintSize + ed25519.SignatureSize
+
+// ErrUnknownSigner is returned when the signer of a payload is not in the keyring
+var ErrUnknownSigner = errors.New("payload is signed by a key that is not in the keyring")
+
+// ErrUnsigned is returned when a keyring is given but the payload carries no signature,
+// since anyone can strip the signature envelope from a signed payload
+var ErrUnsigned = errors.New("payload is not signed, but a keyring of trusted signers was given")
+
+// ErrBadSignature is returned when a payload signature does not verify
+var ErrBadSignature = errors.New("payload signature verification failed")
+
+// SignatureInfo describes the signature found on a payload
+type SignatureInfo struct {
+	// Fingerprint is the hex fingerprint of the signer public key
+	Fingerprint string
+	// Signer is the keyring name of the signer, empty if unknown
+	Signer string
+	// Verified reports whether the signature was checked against a trusted key
+	Verified bool
+}
+
+func (s *SignatureInfo) String() string {
+	if s.Verified {
+		return fmt.Sprintf("signed by %s (%s), signature verified", s.Signer, s.Fingerprint)
+	}
+	return fmt.Sprintf("signed by unknown key %s, signature not verified", s.Fingerprint)
+}
+
+// Fingerprint returns the fingerprint of an Ed25519 public key,
+// the first FingerprintSize bytes of its SHA-256 hash
+func Fingerprint(key ed25519.PublicKey) [FingerprintSize]byte {
+	sum := sha256.Sum256(key)
+	var fp [FingerprintSize]byte
+	copy(fp[:], sum[:])
+	return fp
+}
+
+// GenerateSigningKey creates a new Ed25519 key pair for payload signatures
+func GenerateSigningKey() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+// Sign wraps data into an envelope carrying the signer fingerprint and an Ed25519 signature.
+//
+// The envelope is magic, fingerprint, signature and data; the signature covers
+// the magic, the fingerprint and the data.
+func Sign(data []byte, key ed25519.PrivateKey) []byte {
+	fp := Fingerprint(key.Public().(ed25519.PublicKey))
+
+	out := make([]byte, 0, signedHeaderSize+len(data))
+	out = append(out, signedMagic...)
+	out = append(out, fp[:]...)
+	out = append(out, ed25519.Sign(key, signedMessage(fp[:], data))...)
+	return append(out, data...)
+}
+
+// IsSigned reports whether the payload is wrapped into a signature envelope
+func IsSigned(data []byte) bool {
+	return len(data) >= signedHeaderSize && string(data[:len(signedMagic)]) == signedMagic
+}
+
+// VerifySignature unwraps a signature envelope and checks it against the keyring.
+// Without a keyring unsigned data is returned unchanged with nil info and signed content
+// is returned unverified. With a keyring, unsigned data, unknown signers and bad
+// signatures are errors.
+func VerifySignature(data []byte, keyring *Keyring) ([]byte, *SignatureInfo, error) {
+	if !IsSigned(data) {
+		if keyring != nil {
+			return nil, nil, ErrUnsigned
+		}
+		return data, nil, nil
+	}
+
+	fp := data[len(signedMagic) : len(signedMagic)+FingerprintSize]
+	signature := data[len(signedMagic)+FingerprintSize : signedHeaderSize]
+	content := data[signedHeaderSize:]
+	info := &SignatureInfo{Fingerprint: hex.EncodeToString(fp)}
+
+	if keyring == nil {
+		return content, info, nil
+	}
+
+	entry, ok := keyring.Lookup(fp)
+	if !ok {
+		return nil, info, fmt.Errorf("%w: %s", ErrUnknownSigner, info.Fingerprint)
+	}
+	info.Signer = entry.Name
+
+	if !ed25519.Verify(entry.PublicKey, signedMessage(fp, content), signature) {
+		return nil, info, fmt.Errorf("%w: claimed signer %s", ErrBadSignature, entry.Name)
+	}
+	info.Verified = true
+
+	return content, info, nil
+}
+
+// signedMessage is the byte string covered by the signature
+func signedMessage(fp, data []byte) []byte {
+	msg := make([]byte, 0, len(signedMagic)+len(fp)+len(data))
+	msg = append(msg, signedMagic...)
+	msg = append(msg, fp...)
+	return append(msg, data...)
+}
+
+// KeyringEntry is a trusted signer public key
+type KeyringEntry struct {
+	// Name identifies the signer, taken from the PEM "Name" header or the file name
+	Name string
+	// PublicKey is the Ed25519 verification key
+	PublicKey ed25519.PublicKey
+}
+
+// Keyring is a set of trusted signer keys indexed by fingerprint
+type Keyring struct {
+	entries map[[FingerprintSize]byte]KeyringEntry
+}
+
+// NewKeyring creates an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{entries: make(map[[FingerprintSize]byte]KeyringEntry)}
+}
+
+// Add trusts key under the given name
+func (k *Keyring) Add(name string, key ed25519.PublicKey) {
+	k.entries[Fingerprint(key)] = KeyringEntry{Name: name, PublicKey: key}
+}
+
+// Lookup finds the key with the given fingerprint
+func (k *Keyring) Lookup(fp []byte) (KeyringEntry, bool) {
+	var key [FingerprintSize]byte
+	if len(fp) != FingerprintSize {
+		return KeyringEntry{}, false
+	}
+	copy(key[:], fp)
+	entry, ok := k.entries[key]
+	return entry, ok
+}
+
+// Entries returns the trusted keys sorted by name
+func (k *Keyring) Entries() []KeyringEntry {
+	entries := make([]KeyringEntry, 0, len(k.entries))
+	for _, entry := range k.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// LoadKeyring reads trusted Ed25519 public keys from a PEM file or from every file in a directory.
+// A file may hold several PUBLIC KEY blocks; other files and key types in a directory are skipped.
+func LoadKeyring(path string) (*Keyring, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := NewKeyring()
+	if !info.IsDir() {
+		if err := keyring.addFile(path, true); err != nil {
+			return nil, err
+		}
+		return keyring, nil
+	}
+
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Type().IsRegular() {
+			if err := keyring.addFile(filepath.Join(path, file.Name()), false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(keyring.entries) == 0 {
+		return nil, fmt.Errorf("no Ed25519 public keys found in %s", path)
+	}
+	return keyring, nil
+}
+
+// addFile adds the Ed25519 public keys from a PEM file; strict mode rejects files without any
+func (k *Keyring) addFile(path string, strict bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	found := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != pemPublicKey {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			continue
+		}
+
+		name := block.Headers["Name"]
+		if name == "" {
+			name = base
+		}
+		k.Add(name, pub)
+		found++
+	}
+
+	if strict && found == 0 {
+		return fmt.Errorf("no Ed25519 public keys found in %s", path)
+	}
+	return nil
+}
+
+// LoadSigningKey reads an Ed25519 private key from a PKCS #8 PEM file
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemPrivateKey {
+		return nil, fmt.Errorf("%s: no %s PEM block found", path, pemPrivateKey)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: private key is not an Ed25519 key", path)
+	}
+
+	return priv, nil
+}
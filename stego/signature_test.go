@@ -0,0 +1,89 @@
+package stego
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSignVerify tests that a signed payload verifies against a keyring holding the signer
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	alice, err := GenerateSigningKey()
+	require.NoError(t, err)
+	mallory, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	keyring := NewKeyring()
+	keyring.Add("alice", alice.Public().(ed25519.PublicKey))
+
+	data := []byte("signed payload")
+	signed := Sign(data, alice)
+	assert.True(t, IsSigned(signed))
+
+	content, info, err := VerifySignature(signed, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, data, content)
+	assert.True(t, info.Verified)
+	assert.Equal(t, "alice", info.Signer)
+
+	_, _, err = VerifySignature(Sign(data, mallory), keyring)
+	assert.ErrorIs(t, err, ErrUnknownSigner)
+
+	tampered := append([]byte(nil), signed...)
+	tampered[len(tampered)-1] ^= 1
+	_, info, err = VerifySignature(tampered, keyring)
+	assert.ErrorIs(t, err, ErrBadSignature)
+	assert.Equal(t, "alice", info.Signer)
+
+	content, info, err = VerifySignature(signed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, data, content)
+	assert.False(t, info.Verified)
+
+	content, info, err = VerifySignature(data, nil)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+	assert.Equal(t, data, content)
+
+	// With a keyring, stripping the signature envelope must not pass for authentic data
+	_, _, err = VerifySignature(data, keyring)
+	assert.ErrorIs(t, err, ErrUnsigned)
+}
+
+// TestLoadKeyring tests loading signer keys from files and directories
+func TestLoadKeyring(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	key, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	pubPEM, err := MarshalPublicKey(key.Public())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bob.pub"), pubPEM, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a key"), 0644))
+
+	privPEM, err := MarshalPrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "bob.key")
+	require.NoError(t, os.WriteFile(keyPath, privPEM, 0600))
+
+	loaded, err := LoadSigningKey(keyPath)
+	require.NoError(t, err)
+	assert.True(t, key.Equal(loaded))
+
+	keyring, err := LoadKeyring(dir)
+	require.NoError(t, err)
+	entries := keyring.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bob", entries[0].Name)
+
+	_, err = LoadKeyring(filepath.Join(dir, "notes.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// MissingPiecesError is returned by Join when some pieces of a split payload were not supplied
+type MissingPiecesError struct {
+	// Total is the number of pieces the payload was split into
+	Total int
+	// Missing lists the one-based numbers of the absent pieces
+	Missing []int
+}
+
+func (e *MissingPiecesError) Error() string {
+	parts := make([]string, len(e.Missing))
+	for i, n := range e.Missing {
+		parts[i] = fmt.Sprint(n)
+	}
+	return fmt.Sprintf("missing %d of %d pieces: %s", len(e.Missing), e.Total, strings.Join(parts, ", "))
+}
+
+// Split distributes data over all covers in proportion to their capacity.
+// Every piece carries a payload header with its sequence number and a shared set id,
+// so covers too small for the header are rejected before anything is embedded.
+func Split(alg Steganographer, covers []image.Image, data []byte, config Config) ([]image.Image, error) {
+	if len(covers) == 0 {
+		return nil, errors.New("no cover images to split the payload across")
+	}
+	if len(covers) > math.MaxUint16 {
+		return nil, fmt.Errorf("too many cover images: %d", len(covers))
+	}
+
+	capacities := make([]int, len(covers))
+	total := 0
+	for i, cover := range covers {
+		c, err := alg.Capacity(cover, config)
+		if err != nil {
+			return nil, err
+		}
+		// Every cover carries a header even when its piece is empty
+		if c < PayloadHeaderSize {
+			return nil, fmt.Errorf("cover %d can hold only %d bytes, less than the %d-byte piece header; leave it out",
+				i+1, c, PayloadHeaderSize)
+		}
+		capacities[i] = c - PayloadHeaderSize
+		total += capacities[i]
+	}
+	if len(data) > total {
+		return nil, fmt.Errorf("payload is %d bytes, the covers can hold only %d bytes", len(data), total)
+	}
+
+	sizes := splitSizes(len(data), capacities, total)
+
+	setID, err := NewSetID()
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]image.Image, len(covers))
+	offset := 0
+	for i, cover := range covers {
+		header := PayloadHeader{SetID: setID, Seq: uint16(i), Total: uint16(len(covers))}
+		piece := EncodePayload(header, data[offset:offset+sizes[i]])
+		offset += sizes[i]
+
+		img, err := alg.Embed(cover, piece, config)
+		if err != nil {
+			return nil, fmt.Errorf("piece %d: %w", i+1, err)
+		}
+		images[i] = img
+	}
+
+	return images, nil
+}
+
+// splitSizes divides n bytes proportionally to the capacities, never exceeding any of them
+func splitSizes(n int, capacities []int, total int) []int {
+	sizes := make([]int, len(capacities))
+	if total == 0 {
+		return sizes
+	}
+
+	assigned := 0
+	for i, c := range capacities {
+		sizes[i] = int(int64(n) * int64(c) / int64(total))
+		assigned += sizes[i]
+	}
+	for i := 0; assigned < n; i++ {
+		if sizes[i] < capacities[i] {
+			sizes[i]++
+			assigned++
+		}
+		if i == len(sizes)-1 {
+			i = -1
+		}
+	}
+
+	return sizes
+}
+
+// Join reassembles a payload produced by Split or Share from the images in any order.
+// If pieces are absent it returns a *MissingPiecesError, if there are
+// fewer shares than the threshold it returns an *InsufficientSharesError.
+func Join(alg Steganographer, images []image.Image, config Config) ([]byte, error) {
+	if len(images) == 0 {
+		return nil, errors.New("no images to join")
+	}
+
+	payloads := make([][]byte, len(images))
+	for i, img := range images {
+		data, err := alg.Extract(img, config)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		payloads[i] = data
+	}
+
+	return joinPayloads(payloads)
+}
+
+// joinPayloads reassembles a payload from the data extracted from a set of images.
+// Nil entries stand for images that carry nothing and are skipped; the others are
+// numbered from one in errors by their position.
+func joinPayloads(payloads [][]byte) ([]byte, error) {
+	var first *PayloadHeader
+	bodies := make(map[uint16][]byte)
+	for i, data := range payloads {
+		if data == nil {
+			continue
+		}
+
+		header, body, err := DecodePayload(data)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+
+		if first == nil {
+			first = &header
+		} else if header.SetID != first.SetID || header.Total != first.Total || header.Flags != first.Flags {
+			return nil, fmt.Errorf("image %d belongs to a different payload", i+1)
+		}
+
+		if prev, ok := bodies[header.Seq]; ok && !bytes.Equal(prev, body) {
+			return nil, fmt.Errorf("image %d: conflicting copies of piece %d", i+1, header.Seq+1)
+		}
+		bodies[header.Seq] = body
+	}
+	if first == nil {
+		return nil, errors.New("no image carries a piece of the payload")
+	}
+
+	if first.Flags&FlagShamirShare != 0 {
+		return combinePayloadShares(bodies, int(first.Total))
+	}
+
+	pieces := make([][]byte, first.Total)
+	var missing []int
+	for i := range pieces {
+		body, ok := bodies[uint16(i)]
+		if !ok {
+			missing = append(missing, i+1)
+		}
+		pieces[i] = body
+	}
+	if len(missing) > 0 {
+		return nil, &MissingPiecesError{Total: len(pieces), Missing: missing}
+	}
+
+	return bytes.Join(pieces, nil), nil
+}
+
+// PartPath returns the output path for the given one-based piece number,
+// e.g. "out.png" becomes "out_part2.png"
+func PartPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_part%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
@@ -0,0 +1,115 @@
+package stego
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func splitTestConfig() Config {
+	return Config{
+		EmbeddingRate: 0.5,
+		Params:        FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2.0}.Params(),
+	}
+}
+
+// TestSplitJoin tests that a payload larger than one cover is reassembled in any order
+func TestSplitJoin(t *testing.T) {
+	t.Parallel()
+
+	stego := NewFractalStego()
+	config := splitTestConfig()
+	covers := []image.Image{
+		createTestImage(150, 150),
+		createTestImage(200, 200),
+		createTestImage(120, 120),
+	}
+
+	single, err := stego.Capacity(covers[1], config)
+	require.NoError(t, err)
+
+	data := make([]byte, single+100)
+	for i := range data {
+		data[i] = byte(rand.Intn(256))
+	}
+
+	_, err = stego.Embed(covers[1], data, config)
+	require.Error(t, err)
+
+	images, err := Split(stego, covers, data, config)
+	require.NoError(t, err)
+	require.Len(t, images, 3)
+
+	joined, err := Join(stego, []image.Image{images[2], images[0], images[1]}, config)
+	require.NoError(t, err)
+	assert.Equal(t, data, joined)
+}
+
+// TestJoinMissingPieces tests that absent pieces are reported
+func TestJoinMissingPieces(t *testing.T) {
+	t.Parallel()
+
+	stego := NewFractalStego()
+	config := splitTestConfig()
+	covers := []image.Image{
+		createTestImage(100, 100),
+		createTestImage(100, 100),
+		createTestImage(100, 100),
+	}
+
+	images, err := Split(stego, covers, []byte("split me into three pieces"), config)
+	require.NoError(t, err)
+
+	_, err = Join(stego, []image.Image{images[1]}, config)
+
+	var missingErr *MissingPiecesError
+	require.ErrorAs(t, err, &missingErr)
+	assert.Equal(t, 3, missingErr.Total)
+	assert.Equal(t, []int{1, 3}, missingErr.Missing)
+}
+
+// TestSplitTooLarge tests that a payload exceeding the combined capacity is rejected
+func TestSplitTooLarge(t *testing.T) {
+	t.Parallel()
+
+	covers := []image.Image{createTestImage(50, 50), createTestImage(50, 50)}
+
+	_, err := Split(NewFractalStego(), covers, make([]byte, 5000), splitTestConfig())
+	assert.Error(t, err)
+}
+
+// TestSplitCoverTooSmall tests that a cover without room for a piece header is rejected up front
+func TestSplitCoverTooSmall(t *testing.T) {
+	t.Parallel()
+
+	stego := NewFractalStego()
+	config := splitTestConfig()
+	covers := []image.Image{createTestImage(200, 200), createTestImage(4, 4)}
+
+	small, err := stego.Capacity(covers[1], config)
+	require.NoError(t, err)
+	require.Less(t, small, PayloadHeaderSize)
+
+	_, err = Split(stego, covers, []byte("fits into the first cover"), config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cover 2")
+}
+
+// TestSplitSizes tests that piece sizes cover the payload without exceeding capacities
+func TestSplitSizes(t *testing.T) {
+	t.Parallel()
+
+	capacities := []int{10, 0, 7, 3}
+	sizes := splitSizes(19, capacities, 20)
+
+	sum := 0
+	for i, size := range sizes {
+		assert.LessOrEqual(t, size, capacities[i])
+		sum += size
+	}
+	assert.Equal(t, 19, sum)
+	assert.Equal(t, "out_part2.png", PartPath("out.png", 2))
+}
@@ -0,0 +1,177 @@
+package stego
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"image"
+	"io"
+	"math"
+)
+
+// EmbedStream embeds everything read from r with the algorithm. Algorithms that do not
+// implement StreamSteganographer get the whole payload read into memory first.
+func EmbedStream(s Steganographer, cover image.Image, r io.Reader, config Config) (image.Image, error) {
+	if ss, ok := s.(StreamSteganographer); ok {
+		return ss.EmbedStream(cover, r, config)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Embed(cover, data, config)
+}
+
+// ExtractStream writes the data hidden with the algorithm to w. Algorithms that do not
+// implement StreamSteganographer extract the whole payload into memory first.
+func ExtractStream(s Steganographer, stego image.Image, w io.Writer, config Config) error {
+	if ss, ok := s.(StreamSteganographer); ok {
+		return ss.ExtractStream(stego, w, config)
+	}
+
+	data, err := s.Extract(stego, config)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// EmbedStreamContext is EmbedStream that stops when ctx is done and reports its progress
+func EmbedStreamContext(ctx context.Context, s Steganographer, cover image.Image, r io.Reader, config Config, progress Progress) (image.Image, error) {
+	if ss, ok := s.(StreamSteganographer); ok {
+		return ss.EmbedStreamContext(ctx, cover, r, config, progress)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return EmbedContext(ctx, s, cover, data, config, progress)
+}
+
+// ExtractStreamContext is ExtractStream that stops when ctx is done and reports its progress
+func ExtractStreamContext(ctx context.Context, s Steganographer, stego image.Image, w io.Writer, config Config, progress Progress) error {
+	if ss, ok := s.(StreamSteganographer); ok {
+		return ss.ExtractStreamContext(ctx, stego, w, config, progress)
+	}
+
+	data, err := ExtractContext(ctx, s, stego, config, progress)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// SealStream is SealPayload for data read from r. The header needs the length and checksum
+// of the body, so r is read through once, rewound and returned behind the header.
+func SealStream(r io.ReadSeeker) (io.Reader, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	sum := crc32.NewIEEE()
+	length, err := io.Copy(sum, r)
+	if err != nil {
+		return nil, err
+	}
+	if length > math.MaxUint32 {
+		return nil, fmt.Errorf("payload of %d bytes is too large", length)
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	setID, err := NewSetID()
+	if err != nil {
+		return nil, err
+	}
+	header := appendHeader(nil, PayloadHeader{SetID: setID, Total: 1}, int(length), sum.Sum32())
+	return io.MultiReader(bytes.NewReader(header), io.LimitReader(r, length)), nil
+}
+
+// OpenStream returns a writer that is OpenPayload for the data written to it: the body of
+// a single payload is passed on to w and its checksum is checked by Close. Data without
+// a header is passed on unchanged so older images keep working.
+func OpenStream(w io.Writer) io.WriteCloser {
+	return &payloadOpener{w: w}
+}
+
+// payloadOpener buffers the header, then passes on the body while summing it
+type payloadOpener struct {
+	w      io.Writer
+	head   []byte
+	header *PayloadHeader
+	sum    hash.Hash32
+	left   int64
+	raw    bool
+}
+
+func (o *payloadOpener) Write(p []byte) (int, error) {
+	n := len(p)
+	if o.header == nil && !o.raw {
+		take := min(len(p), PayloadHeaderSize-len(o.head))
+		o.head = append(o.head, p[:take]...)
+		p = p[take:]
+		if len(o.head) < PayloadHeaderSize {
+			if !bytes.HasPrefix([]byte(payloadMagic), o.head[:min(len(o.head), len(payloadMagic))]) {
+				return n, o.passRaw(p)
+			}
+			return n, nil
+		}
+		header, err := decodeHeader(o.head)
+		if errors.Is(err, ErrNoPayloadHeader) {
+			return n, o.passRaw(p)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := checkWhole(header); err != nil {
+			return 0, err
+		}
+		o.header, o.sum, o.left = &header, crc32.NewIEEE(), int64(header.Length)
+	}
+
+	if o.raw {
+		_, err := o.w.Write(p)
+		return n, err
+	}
+	p = p[:min(int64(len(p)), o.left)]
+	o.left -= int64(len(p))
+	o.sum.Write(p)
+	if _, err := o.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// passRaw switches to passing data on unchanged, starting with what was buffered as a header
+func (o *payloadOpener) passRaw(p []byte) error {
+	o.raw = true
+	if _, err := o.w.Write(o.head); err != nil {
+		return err
+	}
+	_, err := o.w.Write(p)
+	return err
+}
+
+// Close checks that the whole body was written and matches the checksum in the header
+func (o *payloadOpener) Close() error {
+	switch {
+	case o.raw:
+		return nil
+	case o.header == nil:
+		_, err := o.w.Write(o.head)
+		return err
+	case o.left > 0:
+		return errors.New("payload is truncated")
+	case o.sum.Sum32() != o.header.Checksum:
+		return errors.New("payload checksum mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStreamRoundTrip tests that streamed payloads match the byte slice API in both directions
+func TestStreamRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	s := NewFractalStego()
+	cover := createTestImage(400, 300)
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+
+	capacity, err := s.Capacity(cover, config)
+	require.NoError(t, err)
+	data := make([]byte, capacity)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// Short reads split the payload at arbitrary points
+	streamed, err := EmbedStream(s, cover, iotest.HalfReader(bytes.NewReader(data)), config)
+	require.NoError(t, err)
+	embedded, err := s.Embed(cover, data, config)
+	require.NoError(t, err)
+	assert.Equal(t, embedded, streamed)
+
+	var out bytes.Buffer
+	require.NoError(t, ExtractStream(s, streamed, &out, config))
+	assert.Equal(t, data, out.Bytes())
+}
+
+// TestEmbedStreamTooLarge tests that a stream longer than the capacity is rejected
+func TestEmbedStreamTooLarge(t *testing.T) {
+	t.Parallel()
+
+	s := NewFractalStego()
+	cover := createTestImage(100, 100)
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+
+	capacity, err := s.Capacity(cover, config)
+	require.NoError(t, err)
+
+	_, err = s.EmbedStream(cover, strings.NewReader(strings.Repeat("x", capacity+1)), config)
+	assert.ErrorContains(t, err, "image too small")
+}
+
+// TestExtractStreamInvalid tests that nothing is written when the image holds no valid length
+func TestExtractStreamInvalid(t *testing.T) {
+	t.Parallel()
+
+	cover := createTestImage(100, 100)
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+
+	// Clear the blue LSBs so the length prefix reads as zero
+	img := cover.(*image.RGBA)
+	for i := 2; i < len(img.Pix); i += 4 {
+		img.Pix[i] &= 0xFE
+	}
+
+	var out bytes.Buffer
+	assert.Error(t, NewFractalStego().ExtractStream(img, &out, config))
+	assert.Zero(t, out.Len())
+}
+
+// TestSealStream tests that streamed sealing and opening match SealPayload and OpenPayload
+func TestSealStream(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 100_000)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	sealed, err := SealStream(bytes.NewReader(data))
+	require.NoError(t, err)
+	payload, err := io.ReadAll(sealed)
+	require.NoError(t, err)
+	opened, err := OpenPayload(payload)
+	require.NoError(t, err)
+	assert.Equal(t, data, opened)
+
+	// Short writes split the header and the body at arbitrary points
+	var out bytes.Buffer
+	w := OpenStream(&out)
+	_, err = io.Copy(w, iotest.HalfReader(bytes.NewReader(payload)))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, data, out.Bytes())
+
+	payload[len(payload)-1] ^= 1
+	w = OpenStream(io.Discard)
+	_, err = w.Write(payload)
+	require.NoError(t, err)
+	assert.ErrorContains(t, w.Close(), "checksum mismatch")
+
+	w = OpenStream(io.Discard)
+	_, err = w.Write(payload[:len(payload)-1])
+	require.NoError(t, err)
+	assert.ErrorContains(t, w.Close(), "truncated")
+}
+
+// TestOpenStreamHeaderless tests that data without a header and single pieces of a split
+// payload are treated like OpenPayload does
+func TestOpenStreamHeaderless(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range [][]byte{[]byte("plain"), []byte("STG"), []byte("legacy payload without a header")} {
+		var out bytes.Buffer
+		w := OpenStream(&out)
+		_, err := w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, data, out.Bytes())
+	}
+
+	piece := EncodePayload(PayloadHeader{Seq: 1, Total: 3}, []byte("piece"))
+	_, err := OpenStream(io.Discard).Write(piece)
+	assert.ErrorContains(t, err, "piece 2 of 3")
+}
+
+// BenchmarkEmbedStream compares the memory of embedding a payload filling a 9-megapixel cover
+// from a slice and from a stream
+func BenchmarkEmbedStream(b *testing.B) {
+	s := NewFractalStego()
+	cover := createTestImage(3000, 3000)
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+	capacity, err := s.Capacity(cover, config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, capacity)
+
+	b.Run("Embed", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if _, err := s.Embed(cover, data, config); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("EmbedStream", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if _, err := s.EmbedStream(cover, bytes.NewReader(data), config); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
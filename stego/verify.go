@@ -0,0 +1,63 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrVerifyFailed is returned when the payload read back from a saved stego image is not the embedded one
+var ErrVerifyFailed = errors.New("payload does not survive saving the stego image")
+
+// Verify checks that extract, which re-reads the saved stego images and extracts from them the
+// way the receiving side will, returns the embedded payload want. It catches output formats
+// and tools that alter the pixels after embedding.
+func Verify(want []byte, extract func() ([]byte, error)) error {
+	got, err := extract()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerifyFailed, err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%w: %d of %d bytes read back differ", ErrVerifyFailed, differingBytes(got, want), len(want))
+	}
+	return nil
+}
+
+// VerifyStream is Verify for payloads too large to hold in memory. want is the SHA-256
+// digest of the embedded payload and extract writes the payload read back to w.
+func VerifyStream(want []byte, extract func(w io.Writer) error) error {
+	sum := sha256.New()
+	counter := &countingWriter{w: sum}
+	if err := extract(counter); err != nil {
+		return fmt.Errorf("%w: %w", ErrVerifyFailed, err)
+	}
+	if !bytes.Equal(sum.Sum(nil), want) {
+		return fmt.Errorf("%w: the %d bytes read back differ", ErrVerifyFailed, counter.n)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// differingBytes counts the positions where a and b differ, the length difference included
+func differingBytes(a, b []byte) int {
+	n := max(len(a), len(b)) - min(len(a), len(b))
+	for i := range min(len(a), len(b)) {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
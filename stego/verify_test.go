@@ -0,0 +1,58 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	cover := translucentNRGBA(120, 90, 7)
+	for i := 3; i < len(cover.Pix); i += 4 {
+		cover.Pix[i] = 0xFF
+	}
+	config := Config{EmbeddingRate: 1, Params: FractalParams{Type: "Mandelbrot", Iterations: 100, Threshold: 2}.Params()}
+	s := NewFractalStego()
+	data := []byte("checked after saving")
+
+	stegoImage, err := s.Embed(cover, data, config)
+	require.NoError(t, err)
+
+	extract := func(img image.Image) func() ([]byte, error) {
+		return func() ([]byte, error) { return s.Extract(img, config) }
+	}
+	assert.NoError(t, Verify(data, extract(pngRoundTrip(t, stegoImage))))
+
+	// Even the best JPEG quality rounds the least significant bits away
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, stegoImage, &jpeg.Options{Quality: 100}))
+	decoded, err := jpeg.Decode(&buf)
+	require.NoError(t, err)
+	assert.ErrorIs(t, Verify(data, extract(decoded)), ErrVerifyFailed)
+
+	assert.ErrorIs(t, Verify(data, func() ([]byte, error) { return []byte("checked after savinG"), nil }), ErrVerifyFailed)
+}
+
+func TestVerifyStream(t *testing.T) {
+	data := []byte("streamed and checked after saving")
+	want := sha256.Sum256(data)
+
+	assert.NoError(t, VerifyStream(want[:], func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}))
+	assert.ErrorIs(t, VerifyStream(want[:], func(w io.Writer) error {
+		_, err := w.Write(data[1:])
+		return err
+	}), ErrVerifyFailed)
+	assert.ErrorIs(t, VerifyStream(want[:], func(io.Writer) error {
+		return errors.New("invalid data length extracted")
+	}), ErrVerifyFailed)
+}